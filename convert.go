@@ -0,0 +1,214 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/satyamsi/migrate/exportyaml"
+	"github.com/satyamsi/migrate/importyaml"
+	"github.com/satyamsi/migrate/rulesetpolicies"
+	"go.aporeto.io/gaia"
+	"go.uber.org/zap"
+)
+
+// stdio is the file name used to designate stdin or stdout.
+const stdio = "-"
+
+func runConvert(args []string) error {
+
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	in := fs.String("in", "", "export file to convert, or '-' to read from stdin")
+	out := fs.String("out", stdio, "file to write the converted objects to, or '-' to write to stdout")
+	format := fs.String("format", string(exportyaml.FormatYAML), "format of the output export: yaml or json")
+	label := fs.String("label", "", "label of the output export (defaults to the label of the input export)")
+	multiportLimit := fs.Int("multiport-limit", rulesetpolicies.DefaultOptions().MultiportLimit, "maximum number of TCP or UDP ports per rule, counting ranges as two (0 disables the split)")
+	continueStrategy := fs.String("continue", string(rulesetpolicies.ContinueStrategyFallThrough), "conversion of the policies with the Continue action: fallthrough (no rule set) or review (disabled rule sets to review)")
+	markerTag := fs.String("marker-tag", rulesetpolicies.DefaultMarkerTag, "tag marking the converted external networks and the rules selecting them, empty to add none")
+	ineffectiveTag := fs.String("ineffective-tag", rulesetpolicies.DefaultIneffectiveTag, "tag marking the rules that match no traffic, empty to add none")
+	dropIneffective := fs.Bool("drop-ineffective", false, "omit the rules that match no traffic instead of marking them with the ineffective tag")
+	strict := fs.Bool("strict", false, "fail the conversion of a policy with a port, or selecting an external network with a service port, that cannot be parsed")
+	explain := fs.Bool("explain", false, "annotate the rule set policies and their rules with the policy, clauses, external network and port intersection they come from")
+	merge := fs.Bool("merge", false, "merge the rule set policies that have the same subject and compatible metadata")
+	deterministic := fs.Bool("deterministic", false, "sort the converted objects, their tags and ports and clear their timestamps to produce the same output for the same policies")
+	verbose := fs.Bool("verbose", false, "print every input policy and its conversion to stderr")
+	logs := addLogFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	logger, err := logs.newLogger()
+	if err != nil {
+		return err
+	}
+
+	if *in == "" {
+		return fmt.Errorf("missing --in")
+	}
+
+	switch rulesetpolicies.ContinueStrategy(*continueStrategy) {
+	case rulesetpolicies.ContinueStrategyFallThrough, rulesetpolicies.ContinueStrategyReview:
+	default:
+		return fmt.Errorf("invalid --continue '%s': must be fallthrough or review", *continueStrategy)
+	}
+
+	bundle, err := readInput(*in, logger)
+	if err != nil {
+		return err
+	}
+
+	if *label == "" {
+		*label = bundle.Label
+	}
+
+	enl := bundle.ExternalNetworks()
+	npl := bundle.NetworkAccessPolicies()
+
+	if *verbose {
+		printVerbose(os.Stderr, fmt.Sprintf("Imported %d External network objects:", len(enl)), enl)
+		printVerbose(os.Stderr, fmt.Sprintf("Imported %d Network policy objects:", len(npl)), npl)
+	}
+
+	opts := rulesetpolicies.DefaultOptions()
+	opts.MultiportLimit = *multiportLimit
+	opts.ContinueStrategy = rulesetpolicies.ContinueStrategy(*continueStrategy)
+	opts.Deterministic = *deterministic
+	opts.MarkerTag = *markerTag
+	opts.IneffectiveTag = *ineffectiveTag
+	opts.DropIneffective = *dropIneffective
+	opts.Strict = *strict
+	opts.Explain = *explain
+	opts.Logger = logger
+
+	if opts.Deterministic {
+		rulesetpolicies.SortNetworkAccessPolicies(npl)
+	}
+
+	// Only the policies selecting an external network with a duplicate name fail
+	duplicates := rulesetpolicies.DuplicateExternalNetworks(enl)
+
+	orl := gaia.NetworkRuleSetPoliciesList{}
+	extnets := rulesetpolicies.NewExternalNetworkSet()
+	report := &rulesetpolicies.Report{}
+
+	// Actual conversion
+	for _, np := range npl {
+
+		if err := rulesetpolicies.CheckDuplicateExternalNetworks(np, duplicates); err != nil {
+			report.Add(rulesetpolicies.NewPolicyError(np, err))
+			continue
+		}
+
+		rsl, netl, warnings, err := rulesetpolicies.ConvertToNetworkRuleSetPolicies(np, enl, opts)
+		if err == nil {
+			if err = extnets.Add(np.Name, netl); err != nil {
+				err = rulesetpolicies.NewPolicyError(np, err)
+			}
+		}
+		report.Add(err)
+		if err != nil {
+			continue
+		}
+		report.AddWarnings(warnings...)
+
+		if *verbose {
+			printVerbose(os.Stderr, "\nInput Network Policy:", np)
+			printVerbose(os.Stderr, "Output Ruleset Policy:", rsl)
+			if len(netl) != 0 {
+				printVerbose(os.Stderr, "Output External Networks:", netl)
+			}
+		}
+
+		orl = append(orl, rsl...)
+	}
+
+	if *merge {
+		var merges []*rulesetpolicies.Merge
+		orl, merges = rulesetpolicies.MergeRuleSetPolicies(orl)
+		report.AddMerges(merges...)
+	}
+
+	enlOut := extnets.WithUnconverted(enl)
+	if opts.Deterministic {
+		rulesetpolicies.SortNetworkRuleSetPolicies(orl)
+		rulesetpolicies.SortExternalNetworks(enlOut)
+	}
+
+	// Every object that is not converted is copied unchanged to the output.
+	// The external networks selected by a policy are replaced by their v2 copy.
+	lists := []exportyaml.List{orl, enlOut}
+	ignored := []string{}
+	for _, identity := range bundle.Identities() {
+		if identity.Name == gaia.NetworkAccessPolicyIdentity.Name || identity.Name == gaia.ExternalNetworkIdentity.Name {
+			continue
+		}
+		objects := bundle.Objects(identity)
+		lists = append(lists, objects)
+		ignored = append(ignored, fmt.Sprintf("%s (%d)", identity.Name, len(objects.List())))
+	}
+
+	outputData, err := exportyaml.NewExport(*label, bundle.APIVersion, lists...)
+	if err != nil {
+		return err
+	}
+
+	data, err := exportyaml.Marshal(outputData, exportyaml.Format(*format))
+	if err != nil {
+		return err
+	}
+
+	if err := writeOutput(*out, data); err != nil {
+		return err
+	}
+
+	report.Write(os.Stderr)
+
+	if len(ignored) != 0 {
+		fmt.Fprintf(os.Stderr, "Ignored identities copied unchanged: %s\n", strings.Join(ignored, ", "))
+	}
+
+	if len(report.Failures) != 0 {
+		return fmt.Errorf("%d network access policies could not be converted", len(report.Failures))
+	}
+
+	return nil
+}
+
+// readInput imports the objects from the given file, or from stdin if filename is '-'.
+func readInput(filename string, logger *zap.Logger) (bundle *importyaml.Bundle, err error) {
+
+	if filename == stdio {
+		bundle, err = importyaml.ImportFromReader(os.Stdin, logger)
+	} else {
+		bundle, err = importyaml.ImportFromFile(filename, logger)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("unable to import '%s': %s", filename, err)
+	}
+
+	return bundle, nil
+}
+
+// writeOutput writes data to the given file, or to stdout if filename is '-'.
+func writeOutput(filename string, data []byte) error {
+
+	if filename == stdio {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+
+	return ioutil.WriteFile(filename, data, 0600)
+}
+
+func printVerbose(w io.Writer, title string, obj interface{}) {
+
+	s, err := o2str(obj)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(w, title)
+	fmt.Fprintln(w, s)
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/satyamsi/migrate/diff"
+)
+
+func runDiff(args []string) error {
+
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "usage: migrate diff old.yaml new.yaml\n\nPrints the network policies and external networks added, removed or modified between two exports.\n\n")
+		fs.PrintDefaults()
+	}
+	logs := addLogFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	logger, err := logs.newLogger()
+	if err != nil {
+		return err
+	}
+
+	if fs.NArg() != 2 {
+		return fmt.Errorf("expected the old and new export files, got %d arguments", fs.NArg())
+	}
+
+	if fs.Arg(0) == stdio && fs.Arg(1) == stdio {
+		return fmt.Errorf("the old and new exports cannot both read from stdin")
+	}
+
+	oldBundle, err := readInput(fs.Arg(0), logger)
+	if err != nil {
+		return err
+	}
+
+	newBundle, err := readInput(fs.Arg(1), logger)
+	if err != nil {
+		return err
+	}
+
+	changes := diff.Compare(oldBundle, newBundle)
+	if len(changes) == 0 {
+		fmt.Fprintf(os.Stdout, "No differences\n")
+		return nil
+	}
+
+	for _, c := range changes {
+		fmt.Fprintf(os.Stdout, "%s\n", c)
+		for _, f := range c.Fields {
+			fmt.Fprintf(os.Stdout, "  - %s\n", f)
+		}
+	}
+
+	return fmt.Errorf("%d objects differ", len(changes))
+}
@@ -0,0 +1,412 @@
+// Package diff compares the network policies and external networks of two exports,
+// to review what changed between two conversion runs or two exports of a namespace.
+package diff
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/satyamsi/migrate/importyaml"
+	"go.aporeto.io/gaia"
+)
+
+// ChangeType is the kind of change of an object.
+type ChangeType string
+
+// Possible change types.
+const (
+	ChangeAdded    ChangeType = "added"
+	ChangeRemoved  ChangeType = "removed"
+	ChangeModified ChangeType = "modified"
+)
+
+// FieldChange is the difference of a field between the old and the new version of an object.
+type FieldChange struct {
+	Field string
+
+	// Old and New are the values of a single valued field.
+	Old string
+	New string
+
+	// Removed and Added are the values removed from and added to a multi valued
+	// field such as clauses, protocols and ports, tags or rules.
+	Removed []string
+	Added   []string
+
+	list bool
+}
+
+func (c *FieldChange) String() string {
+
+	if !c.list {
+		return fmt.Sprintf("%s: %q -> %q", c.Field, c.Old, c.New)
+	}
+
+	parts := []string{}
+	for _, v := range c.Removed {
+		parts = append(parts, "- "+v)
+	}
+	for _, v := range c.Added {
+		parts = append(parts, "+ "+v)
+	}
+
+	return fmt.Sprintf("%s: %s", c.Field, strings.Join(parts, ", "))
+}
+
+// Change is an object added, removed or modified between the old and the new export.
+type Change struct {
+	Type      ChangeType
+	Identity  string
+	Name      string
+	Namespace string
+
+	// Subject is the subject of a policy matched by subject because its name is not unique.
+	Subject string
+
+	// Fields are the differences of a modified object.
+	Fields []*FieldChange
+}
+
+func (c *Change) String() string {
+
+	if c.Subject != "" {
+		return fmt.Sprintf("%s '%s' (namespace: '%s', subject: %s) %s", c.Identity, c.Name, c.Namespace, c.Subject, c.Type)
+	}
+
+	return fmt.Sprintf("%s '%s' (namespace: '%s') %s", c.Identity, c.Name, c.Namespace, c.Type)
+}
+
+// Compare returns the external networks, network access policies and network rule set policies
+// added, removed or modified between the old and the new bundles, in that order of identities
+// and sorted by namespace and name.
+//
+// Objects are matched by namespace and name. The conversion produces several rule set policies
+// with the same name, one per subject clause: when a name is not unique in one of the bundles,
+// the objects are matched by their subject as well.
+func Compare(oldBundle *importyaml.Bundle, newBundle *importyaml.Bundle) []*Change {
+
+	changes := []*Change{}
+	changes = append(changes, compare(gaia.ExternalNetworkIdentity.Name, externalNetworkEntries(oldBundle.ExternalNetworks()), externalNetworkEntries(newBundle.ExternalNetworks()))...)
+	changes = append(changes, compare(gaia.NetworkAccessPolicyIdentity.Name, networkAccessPolicyEntries(oldBundle.NetworkAccessPolicies()), networkAccessPolicyEntries(newBundle.NetworkAccessPolicies()))...)
+	changes = append(changes, compare(gaia.NetworkRuleSetPolicyIdentity.Name, networkRuleSetPolicyEntries(oldBundle.NetworkRuleSetPolicies()), networkRuleSetPolicyEntries(newBundle.NetworkRuleSetPolicies()))...)
+
+	return changes
+}
+
+// field is a named value of an object. List fields hold sorted unique values.
+type field struct {
+	name   string
+	value  string
+	values []string
+	list   bool
+}
+
+func scalar(name string, value string) field {
+	return field{name: name, value: value}
+}
+
+func boolean(name string, value bool) field {
+	return field{name: name, value: strconv.FormatBool(value)}
+}
+
+func list(name string, values []string) field {
+	return field{name: name, values: uniqueSorted(values), list: true}
+}
+
+// entry is an object to compare.
+type entry struct {
+	name      string
+	namespace string
+	subject   string
+	fields    []field
+}
+
+func (e *entry) key(withSubject bool) string {
+
+	k := e.namespace + "\x00" + e.name
+	if withSubject {
+		k += "\x00" + e.subject
+	}
+
+	return k
+}
+
+// compare returns the changes between the old and new entries of an identity.
+func compare(identity string, oldEntries []*entry, newEntries []*entry) []*Change {
+
+	// Names that are not unique in one of the lists are matched along with the subject
+	ambiguous := map[string]bool{}
+	for _, entries := range [][]*entry{oldEntries, newEntries} {
+		counts := map[string]int{}
+		for _, e := range entries {
+			counts[e.key(false)]++
+			if counts[e.key(false)] > 1 {
+				ambiguous[e.key(false)] = true
+			}
+		}
+	}
+
+	// keys returns the key of each entry, numbering the entries that are still not unique
+	keys := func(entries []*entry) ([]string, map[string]*entry) {
+		list := make([]string, len(entries))
+		index := map[string]*entry{}
+		counts := map[string]int{}
+		for i, e := range entries {
+			k := e.key(ambiguous[e.key(false)])
+			if counts[k]++; counts[k] > 1 {
+				k += fmt.Sprintf("\x00%d", counts[k])
+			}
+			list[i] = k
+			index[k] = e
+		}
+		return list, index
+	}
+
+	oldKeys, oldIndex := keys(oldEntries)
+	newKeys, newIndex := keys(newEntries)
+
+	newChange := func(t ChangeType, e *entry) *Change {
+		c := &Change{Type: t, Identity: identity, Name: e.name, Namespace: e.namespace}
+		if ambiguous[e.key(false)] {
+			c.Subject = e.subject
+		}
+		return c
+	}
+
+	changes := []*Change{}
+
+	for _, k := range oldKeys {
+		o, n := oldIndex[k], newIndex[k]
+		if n == nil {
+			changes = append(changes, newChange(ChangeRemoved, o))
+			continue
+		}
+		if fields := compareFields(o.fields, n.fields); len(fields) != 0 {
+			c := newChange(ChangeModified, n)
+			c.Fields = fields
+			changes = append(changes, c)
+		}
+	}
+
+	for _, k := range newKeys {
+		if n := newIndex[k]; oldIndex[k] == nil {
+			changes = append(changes, newChange(ChangeAdded, n))
+		}
+	}
+
+	sort.SliceStable(changes, func(i, j int) bool {
+		a, b := changes[i], changes[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return a.Subject < b.Subject
+	})
+
+	return changes
+}
+
+// compareFields returns the differences between the fields of two objects of the same identity.
+func compareFields(oldFields []field, newFields []field) []*FieldChange {
+
+	changes := []*FieldChange{}
+
+	for i, o := range oldFields {
+		n := newFields[i]
+
+		if !o.list {
+			if o.value != n.value {
+				changes = append(changes, &FieldChange{Field: o.name, Old: o.value, New: n.value})
+			}
+			continue
+		}
+
+		removed := difference(o.values, n.values)
+		added := difference(n.values, o.values)
+		if len(removed) != 0 || len(added) != 0 {
+			changes = append(changes, &FieldChange{Field: o.name, Removed: removed, Added: added, list: true})
+		}
+	}
+
+	return changes
+}
+
+func externalNetworkEntries(extnets gaia.ExternalNetworksList) []*entry {
+
+	entries := make([]*entry, len(extnets))
+	for i, e := range extnets {
+		entries[i] = &entry{
+			name:      e.Name,
+			namespace: e.Namespace,
+			fields: []field{
+				scalar("description", e.Description),
+				list("entries", e.Entries),
+				list("servicePorts", e.ServicePorts),
+				list("associatedTags", e.AssociatedTags),
+				list("metadata", e.Metadata),
+				list("annotations", annotations(e.Annotations)),
+				boolean("propagate", e.Propagate),
+				boolean("protected", e.Protected),
+			},
+		}
+	}
+
+	return entries
+}
+
+func networkAccessPolicyEntries(netpols gaia.NetworkAccessPoliciesList) []*entry {
+
+	entries := make([]*entry, len(netpols))
+	for i, p := range netpols {
+		entries[i] = &entry{
+			name:      p.Name,
+			namespace: p.Namespace,
+			subject:   strings.Join(clauses(p.Subject), " or "),
+			fields: []field{
+				scalar("description", p.Description),
+				scalar("action", string(p.Action)),
+				scalar("applyPolicyMode", string(p.ApplyPolicyMode)),
+				list("subject", clauses(p.Subject)),
+				list("object", clauses(p.Object)),
+				list("ports", p.Ports),
+				list("associatedTags", p.AssociatedTags),
+				list("metadata", p.Metadata),
+				list("annotations", annotations(p.Annotations)),
+				boolean("disabled", p.Disabled),
+				boolean("fallback", p.Fallback),
+				boolean("propagate", p.Propagate),
+				boolean("protected", p.Protected),
+				boolean("logsEnabled", p.LogsEnabled),
+				boolean("observationEnabled", p.ObservationEnabled),
+				scalar("observedTrafficAction", string(p.ObservedTrafficAction)),
+				scalar("activeSchedule", p.ActiveSchedule),
+				scalar("activeDuration", p.ActiveDuration),
+				scalar("expirationTime", timestamp(p.ExpirationTime)),
+			},
+		}
+	}
+
+	return entries
+}
+
+func networkRuleSetPolicyEntries(netpols gaia.NetworkRuleSetPoliciesList) []*entry {
+
+	entries := make([]*entry, len(netpols))
+	for i, p := range netpols {
+		entries[i] = &entry{
+			name:      p.Name,
+			namespace: p.Namespace,
+			subject:   strings.Join(clauses(p.Subject), " or "),
+			fields: []field{
+				scalar("description", p.Description),
+				list("subject", clauses(p.Subject)),
+				list("incomingRules", rules(p.IncomingRules)),
+				list("outgoingRules", rules(p.OutgoingRules)),
+				list("associatedTags", p.AssociatedTags),
+				list("metadata", p.Metadata),
+				list("annotations", annotations(p.Annotations)),
+				boolean("disabled", p.Disabled),
+				boolean("fallback", p.Fallback),
+				boolean("propagate", p.Propagate),
+				boolean("protected", p.Protected),
+			},
+		}
+	}
+
+	return entries
+}
+
+// clauses returns the 'OR' clauses with their tags sorted, like [a=1 b=2].
+func clauses(cs [][]string) []string {
+
+	out := make([]string, len(cs))
+	for i, c := range cs {
+		out[i] = "[" + strings.Join(uniqueSorted(c), " ") + "]"
+	}
+
+	return uniqueSorted(out)
+}
+
+// rules returns a description of each rule, like Allow [a=1] or [b=2] on tcp/80 udp/53.
+func rules(rs []*gaia.NetworkRule) []string {
+
+	out := make([]string, len(rs))
+	for i, r := range rs {
+
+		ports := "any"
+		if len(r.ProtocolPorts) != 0 {
+			ports = strings.Join(uniqueSorted(r.ProtocolPorts), " ")
+		}
+
+		s := fmt.Sprintf("%s %s on %s", r.Action, strings.Join(clauses(r.Object), " or "), ports)
+		if r.ObservationEnabled {
+			s += " (observed)"
+		}
+		if r.LogsDisabled {
+			s += " (logs disabled)"
+		}
+
+		out[i] = s
+	}
+
+	return out
+}
+
+func annotations(a map[string][]string) []string {
+
+	out := make([]string, 0, len(a))
+	for k, v := range a {
+		out = append(out, k+"="+strings.Join(v, ","))
+	}
+
+	return out
+}
+
+func timestamp(t time.Time) string {
+
+	if t.IsZero() {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
+
+// uniqueSorted returns the sorted unique values of the list.
+func uniqueSorted(values []string) []string {
+
+	out := []string{}
+	seen := map[string]struct{}{}
+	for _, v := range values {
+		if _, ok := seen[v]; ok {
+			continue
+		}
+		seen[v] = struct{}{}
+		out = append(out, v)
+	}
+	sort.Strings(out)
+
+	return out
+}
+
+// difference returns the values of a that are not in b.
+func difference(a []string, b []string) []string {
+
+	in := map[string]struct{}{}
+	for _, v := range b {
+		in[v] = struct{}{}
+	}
+
+	out := []string{}
+	for _, v := range a {
+		if _, ok := in[v]; !ok {
+			out = append(out, v)
+		}
+	}
+
+	return out
+}
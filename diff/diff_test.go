@@ -0,0 +1,108 @@
+package diff
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/satyamsi/migrate/importyaml"
+	"go.aporeto.io/gaia"
+)
+
+func TestCompare(t *testing.T) {
+
+	newPolicy := func(name string, ports ...string) *gaia.NetworkAccessPolicy {
+		p := gaia.NewNetworkAccessPolicy()
+		p.Name = name
+		p.Namespace = "/ns"
+		p.Subject = [][]string{{"app=a", "env=prod"}}
+		p.Object = [][]string{{"app=b"}}
+		p.Ports = ports
+		return p
+	}
+
+	newRuleSet := func(subject string, ports ...string) *gaia.NetworkRuleSetPolicy {
+		p := gaia.NewNetworkRuleSetPolicy()
+		p.Name = "rs"
+		p.Namespace = "/ns"
+		p.Subject = [][]string{{subject}}
+		p.OutgoingRules = []*gaia.NetworkRule{{Action: gaia.NetworkRuleActionAllow, Object: [][]string{{"app=b"}}, ProtocolPorts: ports}}
+		return p
+	}
+
+	old := importyaml.NewBundle()
+	old.Add(
+		&gaia.ExternalNetwork{Name: "internet", Entries: []string{"0.0.0.0/0"}},
+		newPolicy("unchanged", "tcp/80"),
+		newPolicy("modified", "tcp/80", "tcp/443"),
+		newPolicy("removed"),
+		newRuleSet("app=a", "tcp/80"),
+		newRuleSet("app=c", "tcp/80"),
+	)
+
+	modified := newPolicy("modified", "tcp/443", "tcp/8443")
+	modified.Action = gaia.NetworkAccessPolicyActionReject
+	modified.Subject = [][]string{{"env=prod", "app=a"}, {"app=c"}}
+
+	unchanged := newPolicy("unchanged", "tcp/80")
+	unchanged.Subject = [][]string{{"env=prod", "app=a"}}
+
+	updated := importyaml.NewBundle()
+	updated.Add(
+		newRuleSet("app=c", "tcp/80"),
+		newRuleSet("app=a", "tcp/8080"),
+		unchanged,
+		modified,
+		newPolicy("added"),
+		&gaia.ExternalNetwork{Name: "internet", Entries: []string{"0.0.0.0/0"}},
+	)
+
+	changes := Compare(old, updated)
+
+	got := []string{}
+	for _, c := range changes {
+		got = append(got, c.String())
+	}
+
+	want := []string{
+		"networkaccesspolicy 'added' (namespace: '/ns') added",
+		"networkaccesspolicy 'modified' (namespace: '/ns') modified",
+		"networkaccesspolicy 'removed' (namespace: '/ns') removed",
+		"networkrulesetpolicy 'rs' (namespace: '/ns', subject: [app=a]) modified",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Compare() = %v, want %v", got, want)
+	}
+
+	fields := []string{}
+	for _, f := range changes[1].Fields {
+		fields = append(fields, f.String())
+	}
+	wantFields := []string{
+		`action: "Allow" -> "Reject"`,
+		"subject: + [app=c]",
+		"ports: - tcp/80, + tcp/8443",
+	}
+	if !reflect.DeepEqual(fields, wantFields) {
+		t.Errorf("Compare() fields = %v, want %v", fields, wantFields)
+	}
+
+	// Rule set policies with the same name are matched by subject
+	fields = []string{}
+	for _, f := range changes[3].Fields {
+		fields = append(fields, f.String())
+	}
+	wantFields = []string{"outgoingRules: - Allow [app=b] on tcp/80, + Allow [app=b] on tcp/8080"}
+	if !reflect.DeepEqual(fields, wantFields) {
+		t.Errorf("Compare() fields = %v, want %v", fields, wantFields)
+	}
+}
+
+func TestCompareIdentical(t *testing.T) {
+
+	b := importyaml.NewBundle()
+	b.Add(&gaia.ExternalNetwork{Name: "internet"}, gaia.NewNetworkAccessPolicy(), gaia.NewNetworkRuleSetPolicy())
+
+	if changes := Compare(b, b); len(changes) != 0 {
+		t.Errorf("Compare() = %v, want no change", changes)
+	}
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/satyamsi/migrate/exportyaml"
+	"github.com/satyamsi/migrate/rulesetpolicies"
+	"go.aporeto.io/gaia"
+)
+
+func runDowngrade(args []string) error {
+
+	fs := flag.NewFlagSet("downgrade", flag.ExitOnError)
+	in := fs.String("in", "", "export file holding the network rule set policies to downgrade, or '-' to read from stdin")
+	out := fs.String("out", stdio, "file to write the network access policies to, or '-' to write to stdout")
+	format := fs.String("format", string(exportyaml.FormatYAML), "format of the output export: yaml or json")
+	label := fs.String("label", "", "label of the output export (defaults to the label of the input export)")
+	markerTag := fs.String("marker-tag", rulesetpolicies.DefaultMarkerTag, "tag the convert command used to mark the converted external networks and the rules selecting them")
+	ineffectiveTag := fs.String("ineffective-tag", rulesetpolicies.DefaultIneffectiveTag, "tag the convert command used to mark the rules that match no traffic")
+	deterministic := fs.Bool("deterministic", false, "sort the network access policies and external networks by namespace and name")
+	logs := addLogFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	logger, err := logs.newLogger()
+	if err != nil {
+		return err
+	}
+
+	if *in == "" {
+		return fmt.Errorf("missing --in")
+	}
+
+	bundle, err := readInput(*in, logger)
+	if err != nil {
+		return err
+	}
+
+	if *label == "" {
+		*label = bundle.Label
+	}
+
+	opts := rulesetpolicies.DefaultOptions()
+	opts.MarkerTag = *markerTag
+	opts.IneffectiveTag = *ineffectiveTag
+	opts.Deterministic = *deterministic
+	opts.Logger = logger
+
+	rsl := bundle.NetworkRuleSetPolicies()
+	npl, enl, warnings, err := rulesetpolicies.ConvertToNetworkAccessPolicies(rsl, bundle.ExternalNetworks(), opts)
+	if err != nil {
+		return err
+	}
+
+	// Every object that is not converted back is copied unchanged to the output.
+	lists := []exportyaml.List{npl, enl}
+	ignored := []string{}
+	for _, identity := range bundle.Identities() {
+		if identity.Name == gaia.NetworkRuleSetPolicyIdentity.Name || identity.Name == gaia.ExternalNetworkIdentity.Name {
+			continue
+		}
+		objects := bundle.Objects(identity)
+		lists = append(lists, objects)
+		ignored = append(ignored, fmt.Sprintf("%s (%d)", identity.Name, len(objects.List())))
+	}
+
+	outputData, err := exportyaml.NewExport(*label, bundle.APIVersion, lists...)
+	if err != nil {
+		return err
+	}
+
+	data, err := exportyaml.Marshal(outputData, exportyaml.Format(*format))
+	if err != nil {
+		return err
+	}
+
+	if err := writeOutput(*out, data); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Downgraded %d network rule set policies to %d network access policies\n", len(rsl), len(npl))
+
+	if len(warnings) != 0 {
+		fmt.Fprintf(os.Stderr, "%d warnings:\n", len(warnings))
+		for _, w := range warnings {
+			fmt.Fprintf(os.Stderr, "  - %s\n", w)
+		}
+	}
+
+	if len(ignored) != 0 {
+		fmt.Fprintf(os.Stderr, "Ignored identities copied unchanged: %s\n", strings.Join(ignored, ", "))
+	}
+
+	return nil
+}
@@ -0,0 +1,115 @@
+package exportyaml
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"go.aporeto.io/elemental"
+	"go.aporeto.io/gaia"
+	"sigs.k8s.io/yaml"
+)
+
+// Format is the encoding of an export document.
+type Format string
+
+// Supported export formats.
+const (
+	FormatYAML Format = "yaml"
+	FormatJSON Format = "json"
+)
+
+// List is a list of objects of a single identity. Both the gaia lists
+// and the objects of an importyaml.Bundle satisfy it.
+type List interface {
+	Identity() elemental.Identity
+	List() elemental.IdentifiablesList
+}
+
+// NewExport builds an export document holding the given lists. The document has
+// the same shape as the one produced by the export feature of the platform, so it
+// can be imported back with importyaml or the platform import feature.
+func NewExport(label string, apiVersion int, lists ...List) (*gaia.Export, error) {
+
+	exportData := gaia.NewExport()
+	exportData.Label = label
+	exportData.APIVersion = apiVersion
+
+	for _, list := range lists {
+
+		objects := list.List()
+		if len(objects) == 0 {
+			continue
+		}
+
+		identity := list.Identity()
+		if _, ok := exportData.Data[identity.Category]; !ok {
+			exportData.Identities = append(exportData.Identities, identity.Name)
+		}
+
+		for _, o := range objects {
+			item, err := toMap(o)
+			if err != nil {
+				return nil, fmt.Errorf("unable to export %s '%s': %s", identity.Name, o.Identifier(), err)
+			}
+			exportData.Data[identity.Category] = append(exportData.Data[identity.Category], item)
+		}
+	}
+
+	return exportData, nil
+}
+
+// Marshal encodes the export document in the given format.
+func Marshal(exportData *gaia.Export, format Format) ([]byte, error) {
+
+	switch format {
+	case FormatYAML:
+		return yaml.Marshal(exportData)
+	case FormatJSON:
+		return json.MarshalIndent(exportData, "", "  ")
+	default:
+		return nil, fmt.Errorf("unsupported format '%s'", format)
+	}
+}
+
+// zeroTime is the encoding of an unset timestamp, which cannot be imported back.
+var zeroTime = time.Time{}.Format(time.RFC3339)
+
+// toMap converts an identifiable into the generic representation used in the
+// data of an export. Like the platform export, it leaves out the attributes
+// that are computed by the backend and unset values.
+func toMap(o elemental.Identifiable) (map[string]interface{}, error) {
+
+	data, err := elemental.Encode(elemental.EncodingTypeJSON, o)
+	if err != nil {
+		return nil, err
+	}
+
+	item := map[string]interface{}{}
+	if err := json.Unmarshal(data, &item); err != nil {
+		return nil, err
+	}
+
+	if s, ok := o.(elemental.AttributeSpecifiable); ok {
+		for name, spec := range s.AttributeSpecifications() {
+			// The namespace is kept so exports spanning several namespaces survive a round trip.
+			if name == "namespace" {
+				if item[name] == "" {
+					delete(item, name)
+				}
+				continue
+			}
+			if spec.ReadOnly && spec.Autogenerated {
+				delete(item, spec.Name)
+			}
+		}
+	}
+
+	for k, v := range item {
+		if v == nil || v == zeroTime {
+			delete(item, k)
+		}
+	}
+
+	return item, nil
+}
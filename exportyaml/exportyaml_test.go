@@ -0,0 +1,122 @@
+package exportyaml
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/satyamsi/migrate/importyaml"
+	"go.aporeto.io/gaia"
+)
+
+func TestNewExport(t *testing.T) {
+
+	extnet := gaia.NewExternalNetwork()
+	extnet.Name = "internet"
+	extnet.AssociatedTags = []string{"ext=internet", "version=v2"}
+	extnet.Entries = []string{"0.0.0.0/0"}
+	extnet.ServicePorts = []string{"tcp/443"}
+
+	policy := gaia.NewNetworkRuleSetPolicy()
+	policy.Name = "policy"
+	policy.Subject = [][]string{{"app=foo"}}
+	policy.OutgoingRules = []*gaia.NetworkRule{
+		{
+			Action:        gaia.NetworkRuleActionAllow,
+			Object:        [][]string{{"$identity=externalnetwork", "$name=internet", "version=v2"}},
+			ProtocolPorts: []string{"tcp/443"},
+		},
+	}
+
+	exportData, err := NewExport("label", 1, gaia.NetworkRuleSetPoliciesList{policy}, gaia.ExternalNetworksList{extnet}, gaia.NetworkAccessPoliciesList{})
+	if err != nil {
+		t.Fatalf("NewExport() error = %v", err)
+	}
+
+	if exportData.Label != "label" || exportData.APIVersion != 1 {
+		t.Errorf("NewExport() label = %s, APIVersion = %d", exportData.Label, exportData.APIVersion)
+	}
+
+	wantIdentities := []string{gaia.NetworkRuleSetPolicyIdentity.Name, gaia.ExternalNetworkIdentity.Name}
+	if !reflect.DeepEqual(exportData.Identities, wantIdentities) {
+		t.Errorf("NewExport() identities = %v, want %v", exportData.Identities, wantIdentities)
+	}
+
+	for _, format := range []Format{FormatYAML, FormatJSON} {
+		t.Run(string(format), func(t *testing.T) {
+
+			data, err := Marshal(exportData, format)
+			if err != nil {
+				t.Fatalf("Marshal() error = %v", err)
+			}
+
+			parsed, err := importyaml.ParseExport(data)
+			if err != nil {
+				t.Fatalf("ParseExport() error = %v", err)
+			}
+
+			if len(parsed.Data[gaia.NetworkRuleSetPolicyIdentity.Category]) != 1 {
+				t.Errorf("ParseExport() network rule set policies = %v", parsed.Data[gaia.NetworkRuleSetPolicyIdentity.Category])
+			}
+
+			bundle, err := importyaml.ImportExport(parsed, nil)
+			if err != nil {
+				t.Fatalf("ImportExport() error = %v", err)
+			}
+
+			if n := len(bundle.NetworkRuleSetPolicies()); n != 1 {
+				t.Errorf("ImportExport() network rule set policies = %d, want 1", n)
+			}
+
+			enl := bundle.ExternalNetworks()
+			if len(enl) != 1 {
+				t.Fatalf("ImportExport() external networks = %v, want 1", len(enl))
+			}
+			if !reflect.DeepEqual(enl[0].AssociatedTags, extnet.AssociatedTags) {
+				t.Errorf("ImportExport() associatedTags = %v, want %v", enl[0].AssociatedTags, extnet.AssociatedTags)
+			}
+			if !reflect.DeepEqual(enl[0].ServicePorts, extnet.ServicePorts) {
+				t.Errorf("ImportExport() servicePorts = %v, want %v", enl[0].ServicePorts, extnet.ServicePorts)
+			}
+		})
+	}
+}
+
+func TestNewExportUnsetTimes(t *testing.T) {
+
+	// Network access policies have an expiration time, unset most of the time
+	policy := gaia.NewNetworkAccessPolicy()
+	policy.Name = "policy"
+	policy.Subject = [][]string{{"app=foo"}}
+	policy.Object = [][]string{{"app=bar"}}
+
+	exportData, err := NewExport("label", 1, gaia.NetworkAccessPoliciesList{policy})
+	if err != nil {
+		t.Fatalf("NewExport() error = %v", err)
+	}
+
+	if _, ok := exportData.Data[gaia.NetworkAccessPolicyIdentity.Category][0]["expirationTime"]; ok {
+		t.Errorf("NewExport() kept the unset expirationTime")
+	}
+
+	data, err := Marshal(exportData, FormatYAML)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	bundle, err := importyaml.ImportFromReader(bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatalf("ImportFromReader() error = %v", err)
+	}
+
+	if npl := bundle.NetworkAccessPolicies(); len(npl) != 1 || npl[0].Name != "policy" {
+		t.Errorf("ImportFromReader() network access policies = %v, want policy", npl)
+	}
+}
+
+func TestMarshalUnsupportedFormat(t *testing.T) {
+
+	if _, err := Marshal(gaia.NewExport(), Format("xml")); err == nil {
+		t.Errorf("Marshal() expected an error")
+	}
+}
@@ -0,0 +1,105 @@
+package importyaml
+
+import (
+	"go.aporeto.io/elemental"
+	"go.aporeto.io/gaia"
+)
+
+// Objects is the list of imported objects of a single identity.
+type Objects struct {
+	identity elemental.Identity
+	list     elemental.IdentifiablesList
+}
+
+// Identity returns the identity of the objects.
+func (o *Objects) Identity() elemental.Identity {
+	return o.identity
+}
+
+// List returns the objects.
+func (o *Objects) List() elemental.IdentifiablesList {
+	return o.list
+}
+
+// A Bundle holds every object decoded from an export, keyed by identity.
+type Bundle struct {
+	Label      string
+	APIVersion int
+
+	identities []elemental.Identity
+	objects    map[string]*Objects
+}
+
+// NewBundle returns a new empty Bundle.
+func NewBundle() *Bundle {
+	return &Bundle{
+		objects: map[string]*Objects{},
+	}
+}
+
+// Add appends the given objects to the bundle.
+func (b *Bundle) Add(objects ...elemental.Identifiable) {
+
+	for _, o := range objects {
+
+		identity := o.Identity()
+
+		l, ok := b.objects[identity.Name]
+		if !ok {
+			l = &Objects{identity: identity}
+			b.objects[identity.Name] = l
+			b.identities = append(b.identities, identity)
+		}
+
+		l.list = append(l.list, o)
+	}
+}
+
+// Identities returns the identities present in the bundle, in import order.
+func (b *Bundle) Identities() []elemental.Identity {
+	return b.identities
+}
+
+// Objects returns the objects of the given identity. It returns an empty list
+// if the bundle has no object of that identity.
+func (b *Bundle) Objects(identity elemental.Identity) *Objects {
+
+	if l, ok := b.objects[identity.Name]; ok {
+		return l
+	}
+
+	return &Objects{identity: identity}
+}
+
+// ExternalNetworks returns the external networks of the bundle.
+func (b *Bundle) ExternalNetworks() gaia.ExternalNetworksList {
+
+	out := gaia.ExternalNetworksList{}
+	for _, o := range b.Objects(gaia.ExternalNetworkIdentity).List() {
+		out = append(out, o.(*gaia.ExternalNetwork))
+	}
+
+	return out
+}
+
+// NetworkAccessPolicies returns the network access policies of the bundle.
+func (b *Bundle) NetworkAccessPolicies() gaia.NetworkAccessPoliciesList {
+
+	out := gaia.NetworkAccessPoliciesList{}
+	for _, o := range b.Objects(gaia.NetworkAccessPolicyIdentity).List() {
+		out = append(out, o.(*gaia.NetworkAccessPolicy))
+	}
+
+	return out
+}
+
+// NetworkRuleSetPolicies returns the network rule set policies of the bundle.
+func (b *Bundle) NetworkRuleSetPolicies() gaia.NetworkRuleSetPoliciesList {
+
+	out := gaia.NetworkRuleSetPoliciesList{}
+	for _, o := range b.Objects(gaia.NetworkRuleSetPolicyIdentity).List() {
+		out = append(out, o.(*gaia.NetworkRuleSetPolicy))
+	}
+
+	return out
+}
@@ -3,38 +3,75 @@ package importyaml
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 
 	"go.aporeto.io/gaia"
+	"go.uber.org/zap"
 	"sigs.k8s.io/yaml"
 )
 
-// ImportFromFile imports the data from a file. It uses the manipulator to write
-// the data to the corresponding target.
-func ImportFromFile(filename string, enl *gaia.ExternalNetworksList, npl *gaia.NetworkAccessPoliciesList) error {
+// ImportFromFile imports the data from a file and returns the decoded objects.
+// The logger is passed to Import.
+func ImportFromFile(filename string, logger *zap.Logger) (*Bundle, error) {
 
 	data, err := ioutil.ReadFile(filename) // #nosec
 	if err != nil {
-		return fmt.Errorf("file error: %s", err)
+		return nil, fmt.Errorf("file error: %s", err)
 	}
 
-	if data == nil {
-		return fmt.Errorf("empty file")
+	exportData, err := ParseExport(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return ImportExport(exportData, logger)
+}
+
+// ImportFromReader imports the data read from r until EOF.
+// The logger is passed to Import.
+func ImportFromReader(r io.Reader, logger *zap.Logger) (*Bundle, error) {
+
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read error: %s", err)
+	}
+
+	exportData, err := ParseExport(data)
+	if err != nil {
+		return nil, err
+	}
+
+	return ImportExport(exportData, logger)
+}
+
+// ParseExport decodes a YAML or JSON export document.
+func ParseExport(data []byte) (*gaia.Export, error) {
+
+	if len(data) == 0 {
+		return nil, fmt.Errorf("empty file")
 	}
 
 	jsonData, err := yaml.YAMLToJSON(data)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	exportData := gaia.NewExport()
 	if err = json.Unmarshal(jsonData, &exportData); err != nil {
-		return err
+		return nil, err
 	}
 
+	return exportData, nil
+}
+
+// ImportExport imports the data of an already decoded export document.
+// The logger is passed to Import.
+func ImportExport(exportData *gaia.Export, logger *zap.Logger) (*Bundle, error) {
+
 	importData := gaia.NewImport()
 	importData.Data = exportData
 	importData.Mode = gaia.ImportModeImport
 
-	return Import(importData, enl, npl)
+	return Import(importData, logger)
 }
@@ -2,38 +2,107 @@ package importyaml
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/mitchellh/mapstructure"
+	"go.aporeto.io/elemental"
 	"go.aporeto.io/gaia"
+	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
 )
 
+// decodeChunkSize is the number of objects decoded by a single goroutine.
+const decodeChunkSize = 256
+
 // Import handles the creates requests for Import.
-func Import(
-	importReq *gaia.Import,
-	enl *gaia.ExternalNetworksList,
-	npl *gaia.NetworkAccessPoliciesList,
-) error {
+//
+// Objects are decoded concurrently, but each decoding job writes to its own
+// slots of a preallocated slice so the results are returned in document order:
+// namespaces first, then the identities in the order of the export identities
+// and finally any other identity in alphabetical order of category.
+// The decoded objects are logged at debug level, nothing is logged if the logger is nil.
+func Import(importReq *gaia.Import, logger *zap.Logger) (*Bundle, error) {
+
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	categories := importOrder(importReq.Data)
+	decoded := make([][]elemental.Identifiable, len(categories))
 
 	var g errgroup.Group
 
-	// We first deal with namespaces
-	if data, ok := importReq.Data.Data[gaia.NamespaceIdentity.Category]; ok {
+	for i, category := range categories {
+
+		data := importReq.Data.Data[category]
+		decoded[i] = make([]elemental.Identifiable, len(data))
+		logger.Debug("decoding objects", zap.String("category", category), zap.Int("count", len(data)))
+
+		for start := 0; start < len(data); start += decodeChunkSize {
+			end := start + decodeChunkSize
+			if end > len(data) {
+				end = len(data)
+			}
+			g.Go(makeImportJobFunc(importReq.Data.Label, importReq.Mode, category, data[start:end], decoded[i][start:end]))
+		}
+	}
+
+	if err := g.Wait(); err != nil {
+		return nil, err
+	}
+
+	logger.Debug("imported export",
+		zap.String("label", importReq.Data.Label),
+		zap.Int("apiVersion", importReq.Data.APIVersion),
+		zap.Int("categories", len(categories)),
+	)
 
-		if err := makeImportJobFunc(importReq.Data.Label, importReq.Mode, gaia.NamespaceIdentity.Category, data, enl, npl)(); err != nil {
-			return err
+	bundle := NewBundle()
+	bundle.Label = importReq.Data.Label
+	bundle.APIVersion = importReq.Data.APIVersion
+
+	for _, objects := range decoded {
+		bundle.Add(objects...)
+	}
+
+	return bundle, nil
+}
+
+// importOrder returns the categories of the export data in the order they must be imported.
+func importOrder(exportData *gaia.Export) []string {
+
+	categories := make([]string, 0, len(exportData.Data))
+	seen := map[string]struct{}{}
+
+	add := func(category string) {
+		if _, ok := exportData.Data[category]; !ok {
+			return
 		}
+		if _, ok := seen[category]; ok {
+			return
+		}
+		seen[category] = struct{}{}
+		categories = append(categories, category)
+	}
+
+	// We first deal with namespaces
+	add(gaia.NamespaceIdentity.Category)
 
-		// then we remove them from the map
-		delete(importReq.Data.Data, gaia.NamespaceIdentity.Category)
+	// Then the identities in the order they are declared
+	for _, name := range exportData.Identities {
+		add(gaia.Manager().IdentityFromName(name).Category)
 	}
 
 	// Then we import the rest
-	for identity := range importReq.Data.Data {
-		g.Go(makeImportJobFunc(importReq.Data.Label, importReq.Mode, identity, importReq.Data.Data[identity], enl, npl))
+	rest := make([]string, 0, len(exportData.Data))
+	for category := range exportData.Data {
+		if _, ok := seen[category]; !ok {
+			rest = append(rest, category)
+		}
 	}
+	sort.Strings(rest)
 
-	return g.Wait()
+	return append(categories, rest...)
 }
 
 func makeImportJobFunc(
@@ -41,8 +110,7 @@ func makeImportJobFunc(
 	mode gaia.ImportModeValue,
 	identity string,
 	data []map[string]interface{},
-	enl *gaia.ExternalNetworksList,
-	npl *gaia.NetworkAccessPoliciesList,
+	out []elemental.Identifiable,
 ) func() error {
 	return func() (err error) {
 
@@ -53,7 +121,7 @@ func makeImportJobFunc(
 		// Then we must decode objects one by one otherwise
 		// nothing will call NewThing and the default values will
 		// not be initialized.
-		for _, item := range data {
+		for idx, item := range data {
 
 			o := gaia.Manager().Identifiable(i)
 			if o == nil {
@@ -64,17 +132,7 @@ func makeImportJobFunc(
 				return fmt.Errorf("bad item for '%s'", identity)
 			}
 
-			en, ok := o.(*gaia.ExternalNetwork)
-			if ok {
-				*enl = append(*enl, en)
-			} else {
-				np, ok := o.(*gaia.NetworkAccessPolicy)
-				if ok {
-					*npl = append(*npl, np)
-				} else {
-					fmt.Println("not sure")
-				}
-			}
+			out[idx] = o
 		}
 
 		return err
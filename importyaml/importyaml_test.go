@@ -0,0 +1,124 @@
+package importyaml
+
+import (
+	"fmt"
+	"testing"
+
+	"go.aporeto.io/gaia"
+)
+
+// TestImportLargeExport imports an export with many objects of several
+// identities. Run it with -race to check the concurrent decoding.
+func TestImportLargeExport(t *testing.T) {
+
+	const count = 3000
+
+	exportData := gaia.NewExport()
+	exportData.Identities = []string{
+		gaia.NetworkAccessPolicyIdentity.Name,
+		gaia.ExternalNetworkIdentity.Name,
+	}
+
+	for i := 0; i < count; i++ {
+		exportData.Data[gaia.ExternalNetworkIdentity.Category] = append(
+			exportData.Data[gaia.ExternalNetworkIdentity.Category],
+			map[string]interface{}{
+				"name":    fmt.Sprintf("extnet-%d", i),
+				"entries": []interface{}{"10.0.0.0/8"},
+			},
+		)
+		exportData.Data[gaia.NetworkAccessPolicyIdentity.Category] = append(
+			exportData.Data[gaia.NetworkAccessPolicyIdentity.Category],
+			map[string]interface{}{
+				"name":    fmt.Sprintf("policy-%d", i),
+				"subject": []interface{}{[]interface{}{"app=a"}},
+				"object":  []interface{}{[]interface{}{"app=b"}},
+			},
+		)
+	}
+
+	exportData.Data[gaia.NamespaceIdentity.Category] = []map[string]interface{}{
+		{"name": "ns"},
+	}
+
+	bundle, err := ImportExport(exportData, nil)
+	if err != nil {
+		t.Fatalf("ImportExport() error = %v", err)
+	}
+
+	enl := bundle.ExternalNetworks()
+	npl := bundle.NetworkAccessPolicies()
+
+	if len(enl) != count {
+		t.Fatalf("ImportExport() external networks = %d, want %d", len(enl), count)
+	}
+	if len(npl) != count {
+		t.Fatalf("ImportExport() network access policies = %d, want %d", len(npl), count)
+	}
+
+	for i := 0; i < count; i++ {
+		if want := fmt.Sprintf("extnet-%d", i); enl[i].Name != want {
+			t.Fatalf("ImportExport() external network %d = %s, want %s", i, enl[i].Name, want)
+		}
+		if want := fmt.Sprintf("policy-%d", i); npl[i].Name != want {
+			t.Fatalf("ImportExport() network access policy %d = %s, want %s", i, npl[i].Name, want)
+		}
+	}
+
+	if n := len(bundle.Objects(gaia.NamespaceIdentity).List()); n != 1 {
+		t.Errorf("ImportExport() namespaces = %d, want 1", n)
+	}
+
+	wantIdentities := []string{
+		gaia.NamespaceIdentity.Name,
+		gaia.NetworkAccessPolicyIdentity.Name,
+		gaia.ExternalNetworkIdentity.Name,
+	}
+	gotIdentities := []string{}
+	for _, identity := range bundle.Identities() {
+		gotIdentities = append(gotIdentities, identity.Name)
+	}
+	if fmt.Sprint(gotIdentities) != fmt.Sprint(wantIdentities) {
+		t.Errorf("ImportExport() identities = %v, want %v", gotIdentities, wantIdentities)
+	}
+}
+
+func TestImportBadItem(t *testing.T) {
+
+	exportData := gaia.NewExport()
+	exportData.Data[gaia.ExternalNetworkIdentity.Category] = []map[string]interface{}{
+		{"name": "ok"},
+		{"name": []interface{}{"not", "a", "string"}},
+	}
+
+	if _, err := ImportExport(exportData, nil); err == nil {
+		t.Errorf("ImportExport() expected an error")
+	}
+}
+
+func Test_importOrder(t *testing.T) {
+
+	exportData := gaia.NewExport()
+	exportData.Identities = []string{
+		gaia.NetworkAccessPolicyIdentity.Name,
+		gaia.NamespaceIdentity.Name,
+	}
+	exportData.Data = map[string][]map[string]interface{}{
+		gaia.NetworkRuleSetPolicyIdentity.Category: nil,
+		gaia.ExternalNetworkIdentity.Category:      nil,
+		gaia.NetworkAccessPolicyIdentity.Category:  nil,
+		gaia.NamespaceIdentity.Category:            nil,
+	}
+
+	want := []string{
+		gaia.NamespaceIdentity.Category,
+		gaia.NetworkAccessPolicyIdentity.Category,
+		gaia.ExternalNetworkIdentity.Category,
+		gaia.NetworkRuleSetPolicyIdentity.Category,
+	}
+
+	got := importOrder(exportData)
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("importOrder() = %v, want %v", got, want)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"go.aporeto.io/gaia"
 	"go.aporeto.io/gaia/protocols"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 // ALLPORTS is a const definition for all ports in a given protocol
@@ -162,13 +163,25 @@ func splitICMPProto(proto string, maxCodes int) []string {
 
 // ExtractProtocolsPorts is a helper function to extract ports for a given protocol from servicePorts.
 // It also returns list of protocols excluding TCP and UDP (i.e. protocols with no ports).
-// The ports is a map of n entries with each n has 15 elements.
-// NOTE: This is required because the iptables `--multiport `
-// supports only a maximum of 15 disjoint ports in a single rule.
+// The ports are returned as a flat list of ports and ranges, use SplitMultiport
+// to group them for rules that must respect the iptables `--multiport` limit.
+// The entries that cannot be parsed are ignored and logged with the global zap logger at
+// error level, see ExtractProtocolsPortsWithLogger.
 func ExtractProtocolsPorts(protocol string, servicePorts []string, restrictedPortList []string) ([]string, []string) {
+	return extractProtocolsPorts(zap.L(), zapcore.ErrorLevel, protocol, servicePorts, restrictedPortList)
+}
+
+// ExtractProtocolsPortsWithLogger is ExtractProtocolsPorts logging the ignored entries with the given
+// logger at debug level. Use FilterProtocolPorts to report them.
+func ExtractProtocolsPortsWithLogger(logger *zap.Logger, protocol string, servicePorts []string, restrictedPortList []string) ([]string, []string) {
+	return extractProtocolsPorts(logger, zapcore.DebugLevel, protocol, servicePorts, restrictedPortList)
+}
+
+// extractProtocolsPorts implements ExtractProtocolsPorts, logging the ignored entries at the given level.
+func extractProtocolsPorts(logger *zap.Logger, level zapcore.Level, protocol string, servicePorts []string, restrictedPortList []string) ([]string, []string) {
 
-	restrictedPortsMap := map[int]struct{}{}
-	filteredServicePorts := map[int]struct{}{}
+	restrictedRanges := []PortRange{}
+	serviceRanges := []PortRange{}
 
 	restrictedProtocols := map[string]struct{}{}
 	serviceProtocols := map[string]struct{}{}
@@ -178,7 +191,7 @@ func ExtractProtocolsPorts(protocol string, servicePorts []string, restrictedPor
 	for _, restrictedPort := range restrictedPortList {
 		rprotocol, rports, err := parseServicePort(restrictedPort)
 		if err != nil {
-			zap.L().Error("unable to parse restrictedPort", zap.Error(err))
+			logIgnoredPort(logger, level, "ignoring invalid restricted port", restrictedPort, err)
 			continue
 		}
 
@@ -202,23 +215,22 @@ func ExtractProtocolsPorts(protocol string, servicePorts []string, restrictedPor
 
 		portSpec, err := NewPortSpecFromString(rports, nil)
 		if err != nil {
+			logIgnoredPort(logger, level, "ignoring invalid restricted port", restrictedPort, err)
 			continue
 		}
 
-		for port := uint32(portSpec.Min); port <= uint32(portSpec.Max); port++ {
-			restrictedPortsMap[int(port)] = struct{}{}
-		}
+		restrictedRanges = append(restrictedRanges, PortRange{Min: int(portSpec.Min), Max: int(portSpec.Max)})
 	}
 
-	if foundalternate && len(restrictedPortsMap) == 0 {
-		restrictedPortsMap[0] = struct{}{}
+	if foundalternate && len(restrictedRanges) == 0 {
+		restrictedRanges = append(restrictedRanges, PortRange{Min: 0, Max: 0})
 	}
 
 	for _, servicePort := range servicePorts {
 
 		sprotocol, sports, err := parseServicePort(servicePort)
 		if err != nil {
-			zap.L().Error("unable to parse servicePort", zap.Error(err))
+			logIgnoredPort(logger, level, "ignoring invalid service port", servicePort, err)
 			continue
 		}
 
@@ -241,21 +253,28 @@ func ExtractProtocolsPorts(protocol string, servicePorts []string, restrictedPor
 
 		portSpec, err := NewPortSpecFromString(sports, nil)
 		if err != nil {
+			logIgnoredPort(logger, level, "ignoring invalid service port", servicePort, err)
 			continue
 		}
 
-		for port := uint32(portSpec.Min); port <= uint32(portSpec.Max); port++ {
-			filteredServicePorts[int(port)] = struct{}{}
-		}
+		serviceRanges = append(serviceRanges, PortRange{Min: int(portSpec.Min), Max: int(portSpec.Max)})
 	}
 
-	intersectedPorts := TrimPortRange(filteredServicePorts, restrictedPortsMap)
+	intersectedPorts := trimPortSet(NewPortSet(serviceRanges...), NewPortSet(restrictedRanges...))
 
 	intersectedProtocols := intersectedProtocols(serviceProtocols, restrictedProtocols)
 
 	return intersectedProtocols, intersectedPorts
 }
 
+// logIgnoredPort logs a port ignored because it cannot be parsed.
+func logIgnoredPort(logger *zap.Logger, level zapcore.Level, msg string, port string, err error) {
+
+	if ce := logger.Check(level, msg); ce != nil {
+		ce.Write(zap.String("port", port), zap.Error(err))
+	}
+}
+
 // parseServicePort returns protocol and ports from servicePort.
 func parseServicePort(servicePort string) (string, string, error) {
 
@@ -275,6 +294,53 @@ func parseServicePort(servicePort string) (string, string, error) {
 	return protocol, ports, nil
 }
 
+// ValidateProtocolPort returns an error if the protocol and ports cannot be used by
+// ExtractProtocolsPorts, either because parseServicePort rejects them or because
+// the TCP or UDP ports are not a valid port or port range.
+func ValidateProtocolPort(protocolPort string) error {
+
+	protocol, ports, err := parseServicePort(protocolPort)
+	if err != nil {
+		return err
+	}
+
+	if !strings.EqualFold(protocol, protocols.L4ProtocolTCP) && !strings.EqualFold(protocol, protocols.L4ProtocolUDP) {
+		return nil
+	}
+
+	if _, err := NewPortSpecFromString(ports, nil); err != nil {
+		return fmt.Errorf("invalid ports '%s': %s", ports, err)
+	}
+
+	return nil
+}
+
+// InvalidProtocolPort is a protocol and port ignored by ExtractProtocolsPorts because it cannot be parsed.
+type InvalidProtocolPort struct {
+	ProtocolPort string
+	Err          error
+}
+
+func (p InvalidProtocolPort) String() string {
+	return fmt.Sprintf("'%s': %s", p.ProtocolPort, p.Err)
+}
+
+// FilterProtocolPorts returns the protocols and ports that pass ValidateProtocolPort and
+// the ones that do not, so the caller can report the entries ExtractProtocolsPorts would ignore.
+func FilterProtocolPorts(protocolPorts []string) (valid []string, invalid []InvalidProtocolPort) {
+
+	valid = []string{}
+	for _, protocolPort := range protocolPorts {
+		if err := ValidateProtocolPort(protocolPort); err != nil {
+			invalid = append(invalid, InvalidProtocolPort{ProtocolPort: protocolPort, Err: err})
+			continue
+		}
+		valid = append(valid, protocolPort)
+	}
+
+	return valid, invalid
+}
+
 // PortSpec is the specification of a port or port range
 type PortSpec struct {
 	Min   uint16 `json:"Min,omitempty"`
@@ -332,39 +398,19 @@ func NewPortSpecFromString(ports string, value interface{}) (*PortSpec, error) {
 // returned are intersection of sports and filteredPortMap.
 func TrimPortRange(filteredServicePorts map[int]struct{}, filteredPortMap map[int]struct{}) []string {
 
-	servicePorts := make([]int, len(filteredServicePorts))
+	return trimPortSet(newPortSetFromMap(filteredServicePorts), newPortSetFromMap(filteredPortMap))
+}
 
-	var i int
-	for port := range filteredServicePorts {
-		servicePorts[i] = port
-		i++
-	}
-	sort.Ints(servicePorts)
+// trimPortSet returns the ranges of the intersection of the service and restricted ports.
+func trimPortSet(servicePorts PortSet, restrictedPorts PortSet) []string {
 
 	// return early if there are no ports in policy
 	// remove this when we remove ports from ext networks
-	if len(filteredPortMap) == 0 {
-		return []string{}
-	}
-
-	// single value
-	if len(servicePorts) == 1 {
-		if _, ok := filteredPortMap[servicePorts[0]]; ok {
-			return buildRanges(servicePorts)
-		}
+	if restrictedPorts.IsEmpty() {
 		return []string{}
 	}
 
-	// range
-	includePorts := []int{}
-	for _, port := range servicePorts {
-		if _, ok := filteredPortMap[port]; !ok {
-			continue
-		}
-		includePorts = append(includePorts, port)
-	}
-
-	return buildRanges(includePorts)
+	return servicePorts.Intersect(restrictedPorts).Strings()
 }
 
 // fmtRange will return a string array with one member in the form
@@ -380,29 +426,10 @@ func fmtRange(start, end int) []string {
 	return []string{r}
 }
 
-// buildRangesR is a recursive function to return a list of ranges
-// representing the numbers in the ports list.
-// ports list is expected to be sorted in ascending order.
-func buildRangesR(ports []int, start, curr int) []string {
-	if len(ports) == 1 {
-		return fmtRange(start, curr)
-	}
-	// len(ports) > 1
-	sports := []string{}
-	if ports[0]+1 != ports[1] {
-		sports = fmtRange(start, curr)
-		start = ports[1]
-	}
-	return append(sports, buildRangesR(ports[1:], start, ports[1])...)
-}
-
 // buildRanges returns a list of ranges to represent ports in the ports list.
 // ports list is expected to be sorted in ascending order.
 func buildRanges(ports []int) []string {
-	if len(ports) == 0 {
-		return []string{}
-	}
-	return buildRangesR(ports, ports[0], ports[0])
+	return newPortSetFromPorts(ports).Strings()
 }
 
 // intersectedProtocols returns the intersection of the service and restricted protocols.
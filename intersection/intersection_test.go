@@ -5,6 +5,9 @@ import (
 	"testing"
 
 	. "github.com/smartystreets/goconvey/convey"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func Test_IntersectedICMP(t *testing.T) {
@@ -681,6 +684,70 @@ func TestNewPortSpecFromString(t *testing.T) {
 	})
 }
 
+func TestValidateProtocolPort(t *testing.T) {
+
+	for _, valid := range []string{"tcp/80", "TCP/80:90", "udp/53", "any", "icmp", "icmp/8/0"} {
+		if err := ValidateProtocolPort(valid); err != nil {
+			t.Errorf("ValidateProtocolPort(%s) error = %v", valid, err)
+		}
+	}
+
+	for _, invalid := range []string{"tcp", "tcp/80-90", "tcp/70000", "udp/90:80", "foo/80", "any/80"} {
+		if err := ValidateProtocolPort(invalid); err == nil {
+			t.Errorf("ValidateProtocolPort(%s) expected an error", invalid)
+		}
+	}
+}
+
+func TestExtractProtocolsPortsLogs(t *testing.T) {
+
+	servicePorts := []string{"tcp/80", "tcp/80-90"}
+
+	t.Run("global logger", func(t *testing.T) {
+
+		core, logs := observer.New(zap.DebugLevel)
+		defer zap.ReplaceGlobals(zap.New(core))()
+
+		ExtractProtocolsPorts("tcp", servicePorts, []string{"tcp/80"})
+
+		entries := logs.FilterMessage("ignoring invalid service port").All()
+		if len(entries) != 1 || entries[0].Level != zapcore.ErrorLevel || entries[0].ContextMap()["port"] != "tcp/80-90" {
+			t.Errorf("ExtractProtocolsPorts() logs = %v, want the invalid port at error level", entries)
+		}
+	})
+
+	t.Run("given logger", func(t *testing.T) {
+
+		core, logs := observer.New(zap.DebugLevel)
+
+		ExtractProtocolsPortsWithLogger(zap.New(core), "tcp", servicePorts, []string{"tcp/80"})
+
+		entries := logs.FilterMessage("ignoring invalid service port").All()
+		if len(entries) != 1 || entries[0].Level != zapcore.DebugLevel {
+			t.Errorf("ExtractProtocolsPortsWithLogger() logs = %v, want the invalid port at debug level", entries)
+		}
+	})
+}
+
+func TestFilterProtocolPorts(t *testing.T) {
+
+	valid, invalid := FilterProtocolPorts([]string{"tcp/80", "tcp/80-90", "icmp/8/0", "udp/70000"})
+
+	if !reflect.DeepEqual(valid, []string{"tcp/80", "icmp/8/0"}) {
+		t.Errorf("FilterProtocolPorts() valid = %v", valid)
+	}
+
+	if len(invalid) != 2 || invalid[0].ProtocolPort != "tcp/80-90" || invalid[1].ProtocolPort != "udp/70000" {
+		t.Fatalf("FilterProtocolPorts() invalid = %v", invalid)
+	}
+
+	for _, p := range invalid {
+		if p.Err == nil {
+			t.Errorf("FilterProtocolPorts() missing error for '%s'", p.ProtocolPort)
+		}
+	}
+}
+
 func Test_buildRanges(t *testing.T) {
 	type args struct {
 		ports []int
@@ -0,0 +1,47 @@
+package intersection
+
+import (
+	"strings"
+)
+
+// MultiportLimit is the maximum number of ports iptables `--multiport`
+// supports in a single rule. A range counts as two ports.
+const MultiportLimit = 15
+
+// SplitMultiport splits a list of ports and port ranges into groups that hold at
+// most limit ports, counting a range as two ports like iptables `--multiport`
+// does. The order of the ports is preserved. A limit lower than two disables
+// the split and returns the ports as a single group.
+func SplitMultiport(ports []string, limit int) [][]string {
+
+	if len(ports) == 0 {
+		return [][]string{}
+	}
+
+	if limit < 2 {
+		return [][]string{ports}
+	}
+
+	groups := [][]string{}
+	group := []string{}
+	count := 0
+
+	for _, port := range ports {
+
+		weight := 1
+		if strings.Contains(port, ":") {
+			weight = 2
+		}
+
+		if count+weight > limit {
+			groups = append(groups, group)
+			group = []string{}
+			count = 0
+		}
+
+		group = append(group, port)
+		count += weight
+	}
+
+	return append(groups, group)
+}
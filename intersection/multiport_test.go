@@ -0,0 +1,40 @@
+package intersection
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestSplitMultiport(t *testing.T) {
+
+	ports := func(n int) []string {
+		out := make([]string, n)
+		for i := range out {
+			out[i] = fmt.Sprintf("%d", 1000+i)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name  string
+		ports []string
+		limit int
+		want  [][]string
+	}{
+		{"empty", nil, 15, [][]string{}},
+		{"under the limit", []string{"80", "443"}, 15, [][]string{{"80", "443"}}},
+		{"exactly the limit", ports(15), 15, [][]string{ports(15)}},
+		{"over the limit", ports(16), 15, [][]string{ports(15), ports(16)[15:]}},
+		{"ranges count as two", []string{"1:10", "20:30", "40"}, 4, [][]string{{"1:10", "20:30"}, {"40"}}},
+		{"range does not fit", []string{"1", "2", "3", "10:20"}, 4, [][]string{{"1", "2", "3"}, {"10:20"}}},
+		{"disabled", ports(20), 0, [][]string{ports(20)}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := SplitMultiport(tt.ports, tt.limit); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("SplitMultiport() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
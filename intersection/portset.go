@@ -0,0 +1,185 @@
+package intersection
+
+import (
+	"sort"
+)
+
+// PortRange is an inclusive range of ports.
+type PortRange struct {
+	Min int
+	Max int
+}
+
+// PortSet is a set of ports stored as a sorted list of disjoint and non
+// adjacent ranges. Operations on a PortSet cost a function of the number of
+// ranges, not of the number of ports they hold.
+type PortSet []PortRange
+
+// NewPortSet returns the normalized set of ports covered by the given ranges.
+// Ranges with Min greater than Max are ignored.
+func NewPortSet(ranges ...PortRange) PortSet {
+	return PortSet(ranges).Normalize()
+}
+
+// newPortSetFromPorts returns the set holding the given ports.
+func newPortSetFromPorts(ports []int) PortSet {
+
+	ranges := make([]PortRange, len(ports))
+	for i, port := range ports {
+		ranges[i] = PortRange{Min: port, Max: port}
+	}
+
+	return NewPortSet(ranges...)
+}
+
+// newPortSetFromMap returns the set holding the keys of the given map.
+func newPortSetFromMap(ports map[int]struct{}) PortSet {
+
+	ranges := make([]PortRange, 0, len(ports))
+	for port := range ports {
+		ranges = append(ranges, PortRange{Min: port, Max: port})
+	}
+
+	return NewPortSet(ranges...)
+}
+
+// Normalize returns a copy of the set with its ranges sorted and the overlapping
+// or adjacent ranges merged.
+func (s PortSet) Normalize() PortSet {
+
+	ranges := make([]PortRange, 0, len(s))
+	for _, r := range s {
+		if r.Min <= r.Max {
+			ranges = append(ranges, r)
+		}
+	}
+
+	sort.Slice(ranges, func(i, j int) bool {
+		return ranges[i].Min < ranges[j].Min
+	})
+
+	out := PortSet{}
+	for _, r := range ranges {
+		if last := len(out) - 1; last >= 0 && r.Min <= out[last].Max+1 {
+			if r.Max > out[last].Max {
+				out[last].Max = r.Max
+			}
+			continue
+		}
+		out = append(out, r)
+	}
+
+	return out
+}
+
+// Union returns the ports that are in s or in o.
+func (s PortSet) Union(o PortSet) PortSet {
+
+	ranges := make([]PortRange, 0, len(s)+len(o))
+	ranges = append(ranges, s...)
+	ranges = append(ranges, o...)
+
+	return NewPortSet(ranges...)
+}
+
+// Intersect returns the ports that are both in s and in o.
+// Both sets are expected to be normalized.
+func (s PortSet) Intersect(o PortSet) PortSet {
+
+	out := PortSet{}
+
+	for i, j := 0, 0; i < len(s) && j < len(o); {
+
+		min := s[i].Min
+		if o[j].Min > min {
+			min = o[j].Min
+		}
+
+		max := s[i].Max
+		if o[j].Max < max {
+			max = o[j].Max
+		}
+
+		if min <= max {
+			out = append(out, PortRange{Min: min, Max: max})
+		}
+
+		if s[i].Max < o[j].Max {
+			i++
+		} else {
+			j++
+		}
+	}
+
+	return out
+}
+
+// Subtract returns the ports that are in s but not in o.
+// Both sets are expected to be normalized.
+func (s PortSet) Subtract(o PortSet) PortSet {
+
+	out := PortSet{}
+
+	j := 0
+	for _, r := range s {
+
+		min := r.Min
+
+		// Skip the ranges of o that end before r
+		for j < len(o) && o[j].Max < min {
+			j++
+		}
+
+		for k := j; k < len(o) && o[k].Min <= r.Max; k++ {
+			if o[k].Min > min {
+				out = append(out, PortRange{Min: min, Max: o[k].Min - 1})
+			}
+			if o[k].Max+1 > min {
+				min = o[k].Max + 1
+			}
+		}
+
+		if min <= r.Max {
+			out = append(out, PortRange{Min: min, Max: r.Max})
+		}
+	}
+
+	return out
+}
+
+// Contains returns true if the port is in the set.
+func (s PortSet) Contains(port int) bool {
+
+	i := sort.Search(len(s), func(i int) bool {
+		return s[i].Max >= port
+	})
+
+	return i < len(s) && s[i].Min <= port
+}
+
+// Len returns the number of ports in the set.
+func (s PortSet) Len() int {
+
+	n := 0
+	for _, r := range s {
+		n += r.Max - r.Min + 1
+	}
+
+	return n
+}
+
+// IsEmpty returns true if the set holds no port.
+func (s PortSet) IsEmpty() bool {
+	return len(s) == 0
+}
+
+// Strings returns the ranges of the set in the "min:max" or "port" notation.
+func (s PortSet) Strings() []string {
+
+	out := make([]string, 0, len(s))
+	for _, r := range s {
+		out = append(out, fmtRange(r.Min, r.Max)...)
+	}
+
+	return out
+}
@@ -0,0 +1,173 @@
+package intersection
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestNewPortSet(t *testing.T) {
+
+	tests := []struct {
+		name   string
+		ranges []PortRange
+		want   PortSet
+	}{
+		{"empty", nil, PortSet{}},
+		{"single", []PortRange{{80, 80}}, PortSet{{80, 80}}},
+		{"unsorted", []PortRange{{443, 443}, {80, 80}}, PortSet{{80, 80}, {443, 443}}},
+		{"overlapping", []PortRange{{80, 100}, {90, 120}}, PortSet{{80, 120}}},
+		{"adjacent", []PortRange{{80, 89}, {90, 99}}, PortSet{{80, 99}}},
+		{"contained", []PortRange{{1, 65535}, {80, 90}}, PortSet{{1, 65535}}},
+		{"invalid", []PortRange{{90, 80}, {22, 22}}, PortSet{{22, 22}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewPortSet(tt.ranges...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("NewPortSet() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPortSetOperations(t *testing.T) {
+
+	a := NewPortSet(PortRange{1, 100}, PortRange{200, 300}, PortRange{443, 443})
+	b := NewPortSet(PortRange{50, 250}, PortRange{443, 8080})
+
+	tests := []struct {
+		name string
+		got  PortSet
+		want PortSet
+	}{
+		{"union", a.Union(b), PortSet{{1, 300}, {443, 8080}}},
+		{"intersect", a.Intersect(b), PortSet{{50, 100}, {200, 250}, {443, 443}}},
+		{"subtract a-b", a.Subtract(b), PortSet{{1, 49}, {251, 300}}},
+		{"subtract b-a", b.Subtract(a), PortSet{{101, 199}, {444, 8080}}},
+		{"intersect empty", a.Intersect(PortSet{}), PortSet{}},
+		{"subtract empty", a.Subtract(PortSet{}), a},
+		{"subtract all", a.Subtract(NewPortSet(PortRange{1, 65535})), PortSet{}},
+		{"subtract hole", NewPortSet(PortRange{1, 65535}).Subtract(NewPortSet(PortRange{80, 80})), PortSet{{1, 79}, {81, 65535}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if !reflect.DeepEqual(tt.got, tt.want) {
+				t.Errorf("got %v, want %v", tt.got, tt.want)
+			}
+		})
+	}
+
+	if !a.Contains(443) || !a.Contains(1) || !a.Contains(250) || a.Contains(150) || a.Contains(444) {
+		t.Errorf("Contains() returned unexpected results for %v", a)
+	}
+
+	if n := a.Len(); n != 202 {
+		t.Errorf("Len() = %d, want 202", n)
+	}
+
+	if got, want := a.Strings(), []string{"1:100", "200:300", "443"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Strings() = %v, want %v", got, want)
+	}
+
+	if got := (PortSet{}).Strings(); got == nil || len(got) != 0 {
+		t.Errorf("Strings() = %#v, want empty non nil slice", got)
+	}
+}
+
+// perPortIntersection is the previous implementation of the port intersection,
+// kept to compare it with the interval based one.
+func perPortIntersection(service []PortRange, restricted []PortRange) []string {
+
+	servicePorts := map[int]struct{}{}
+	for _, r := range service {
+		for port := r.Min; port <= r.Max; port++ {
+			servicePorts[port] = struct{}{}
+		}
+	}
+
+	restrictedPorts := map[int]struct{}{}
+	for _, r := range restricted {
+		for port := r.Min; port <= r.Max; port++ {
+			restrictedPorts[port] = struct{}{}
+		}
+	}
+
+	ports := []int{}
+	for port := range servicePorts {
+		if _, ok := restrictedPorts[port]; ok {
+			ports = append(ports, port)
+		}
+	}
+	sort.Ints(ports)
+
+	return buildRanges(ports)
+}
+
+func TestPortSetMatchesPerPortIntersection(t *testing.T) {
+
+	service := []PortRange{{1, 1024}, {8000, 9000}, {9100, 9100}, {30000, 32767}}
+	restricted := []PortRange{{22, 22}, {80, 443}, {1000, 8080}, {9000, 9200}, {32000, 65535}}
+
+	want := perPortIntersection(service, restricted)
+	got := NewPortSet(service...).Intersect(NewPortSet(restricted...)).Strings()
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Intersect() = %v, want %v", got, want)
+	}
+}
+
+// largeServicePorts returns the service ports of n external networks.
+func largeServicePorts(n int) []string {
+
+	ports := []string{}
+	for i := 0; i < n; i++ {
+		ports = append(ports, fmt.Sprintf("tcp/%d:%d", 1000+i*100, 1050+i*100), fmt.Sprintf("tcp/%d", 20000+i))
+	}
+
+	return ports
+}
+
+func BenchmarkExtractProtocolsPortsAny(b *testing.B) {
+
+	servicePorts := largeServicePorts(200)
+	restricted := []string{"any"}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ExtractProtocolsPorts("tcp", servicePorts, restricted)
+	}
+}
+
+func BenchmarkExtractProtocolsPortsFullRange(b *testing.B) {
+
+	servicePorts := []string{"tcp/1:65535"}
+	restricted := []string{"tcp/1:65535"}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		ExtractProtocolsPorts("tcp", servicePorts, restricted)
+	}
+}
+
+func BenchmarkIntersectionPortSet(b *testing.B) {
+
+	service := []PortRange{{1, 65535}}
+	restricted := []PortRange{{1, 1024}, {8000, 9000}, {30000, 65535}}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		NewPortSet(service...).Intersect(NewPortSet(restricted...)).Strings()
+	}
+}
+
+func BenchmarkIntersectionPerPort(b *testing.B) {
+
+	service := []PortRange{{1, 65535}}
+	restricted := []PortRange{{1, 1024}, {8000, 9000}, {30000, 65535}}
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		perPortIntersection(service, restricted)
+	}
+}
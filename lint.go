@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/satyamsi/migrate/lint"
+)
+
+func runLint(args []string) error {
+
+	var disabled tagList
+
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	in := fs.String("in", "", "export file holding the network access policies to check, or '-' to read from stdin")
+	fs.Var(&disabled, "disable", "name of a check to skip, can be repeated")
+	list := fs.Bool("list", false, "list the checks and exit")
+	logs := addLogFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	logger, err := logs.newLogger()
+	if err != nil {
+		return err
+	}
+
+	checks, err := lint.Disable(lint.DefaultChecks(), disabled...)
+	if err != nil {
+		return err
+	}
+
+	if *list {
+		for _, check := range checks {
+			fmt.Fprintln(os.Stdout, check.Name())
+		}
+		return nil
+	}
+
+	if *in == "" {
+		return fmt.Errorf("missing --in")
+	}
+
+	bundle, err := readInput(*in, logger)
+	if err != nil {
+		return err
+	}
+
+	findings := lint.Run(&lint.Input{
+		NetworkAccessPolicies: bundle.NetworkAccessPolicies(),
+		ExternalNetworks:      bundle.ExternalNetworks(),
+	}, checks...)
+
+	for _, f := range findings {
+		fmt.Fprintf(os.Stdout, "%s\n", f)
+	}
+
+	fmt.Fprintf(os.Stdout, "%d findings\n", len(findings))
+
+	if lint.HasErrors(findings) {
+		return fmt.Errorf("the policies have errors")
+	}
+
+	return nil
+}
@@ -0,0 +1,220 @@
+package lint
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/satyamsi/migrate/intersection"
+	"github.com/satyamsi/migrate/rulesetpolicies"
+)
+
+const (
+	identityExternalNetwork = "$identity=externalnetwork"
+	namespacePrefix         = "$namespace="
+)
+
+// namespaceOnlySubjectCheck reports the subject clauses made of namespace tags only.
+type namespaceOnlySubjectCheck struct{}
+
+func (c namespaceOnlySubjectCheck) Name() string { return "namespace-only-subject" }
+
+func (c namespaceOnlySubjectCheck) Run(input *Input) []*Finding {
+
+	findings := []*Finding{}
+
+	for _, netpol := range input.NetworkAccessPolicies {
+		for _, clause := range netpol.Subject {
+
+			namespaceOnly := len(clause) != 0
+			for _, tag := range clause {
+				if !strings.HasPrefix(tag, namespacePrefix) {
+					namespaceOnly = false
+					break
+				}
+			}
+
+			if namespaceOnly {
+				findings = append(findings, newPolicyFinding(c, SeverityWarning, netpol,
+					"add tags selecting the intended processing units to the clause",
+					"subject clause %v only selects a namespace: every processing unit and external network of the namespace matches it", clause))
+			}
+		}
+	}
+
+	return findings
+}
+
+// unsatisfiableClauseCheck reports the clauses that can never match: empty clauses and
+// clauses requiring two different values of a metadata attribute.
+type unsatisfiableClauseCheck struct{}
+
+func (c unsatisfiableClauseCheck) Name() string { return "unsatisfiable-clause" }
+
+func (c unsatisfiableClauseCheck) Run(input *Input) []*Finding {
+
+	findings := []*Finding{}
+
+	for _, netpol := range input.NetworkAccessPolicies {
+		for _, side := range []struct {
+			name    string
+			clauses [][]string
+		}{
+			{"subject", netpol.Subject},
+			{"object", netpol.Object},
+		} {
+			for _, clause := range side.clauses {
+				if reason := unsatisfiable(clause); reason != "" {
+					findings = append(findings, newPolicyFinding(c, SeverityWarning, netpol,
+						"remove the clause or the conflicting tags",
+						"%s clause %v can never match: %s", side.name, clause, reason))
+				}
+			}
+		}
+	}
+
+	return findings
+}
+
+// unsatisfiable returns why a clause can never match, or an empty string.
+func unsatisfiable(clause []string) string {
+
+	if len(clause) == 0 {
+		return "it is empty"
+	}
+
+	// An object has a single identity, namespace, name and ID
+	values := map[string]string{}
+	for _, tag := range clause {
+
+		if !strings.HasPrefix(tag, "$") {
+			continue
+		}
+
+		i := strings.Index(tag, "=")
+		if i < 0 {
+			continue
+		}
+
+		key, value := tag[:i+1], tag[i+1:]
+		switch key {
+		case "$identity=":
+			value = strings.ToLower(value)
+		case "$namespace=", "$name=", "$id=":
+		default:
+			continue
+		}
+
+		if v, ok := values[key]; ok && v != value {
+			return fmt.Sprintf("it requires both '%s%s' and '%s%s'", key, v, key, value)
+		}
+		values[key] = value
+	}
+
+	return ""
+}
+
+// unknownSelectorCheck reports the clauses selecting external networks by metadata tags the
+// conversion cannot evaluate. Clauses selecting processing units are not matched against the
+// external networks by the conversion and are left out.
+type unknownSelectorCheck struct{}
+
+func (c unknownSelectorCheck) Name() string { return "unknown-selector" }
+
+func (c unknownSelectorCheck) Run(input *Input) []*Finding {
+
+	findings := []*Finding{}
+
+	for _, netpol := range input.NetworkAccessPolicies {
+		for _, clause := range append(append([][]string{}, netpol.Subject...), netpol.Object...) {
+
+			if !containsFold(clause, identityExternalNetwork) {
+				continue
+			}
+
+			if _, err := rulesetpolicies.MatchExternalNetworks(clause, input.ExternalNetworks, netpol.Namespace); err != nil {
+				findings = append(findings, newPolicyFinding(c, SeverityError, netpol,
+					"remove the metadata tag or replace it with tags of the external networks",
+					"clause %v cannot be matched against the external networks: %s", clause, err))
+			}
+		}
+	}
+
+	return findings
+}
+
+// missingExternalNetworkCheck reports the clauses selecting external networks that do not exist
+// or are not visible from the namespace of the policy.
+type missingExternalNetworkCheck struct{}
+
+func (c missingExternalNetworkCheck) Name() string { return "missing-external-network" }
+
+func (c missingExternalNetworkCheck) Run(input *Input) []*Finding {
+
+	findings := []*Finding{}
+
+	for _, netpol := range input.NetworkAccessPolicies {
+		for _, clause := range append(append([][]string{}, netpol.Subject...), netpol.Object...) {
+
+			// Clauses that can never match are reported by the unsatisfiable-clause check
+			if !containsFold(clause, identityExternalNetwork) || unsatisfiable(clause) != "" {
+				continue
+			}
+
+			extnets, err := rulesetpolicies.MatchExternalNetworks(clause, input.ExternalNetworks, netpol.Namespace)
+			if err != nil {
+				// Reported by the unknown-selector check
+				continue
+			}
+
+			if len(extnets) == 0 {
+				findings = append(findings, newPolicyFinding(c, SeverityError, netpol,
+					"create the external network in the namespace of the policy or a parent namespace with propagation, or fix the clause",
+					"clause %v selects no external network", clause))
+			}
+		}
+	}
+
+	return findings
+}
+
+// invalidPortCheck reports the protocols and ports of the policies and the service ports of the
+// external networks that the conversion cannot parse and would silently leave out.
+type invalidPortCheck struct{}
+
+func (c invalidPortCheck) Name() string { return "invalid-port" }
+
+func (c invalidPortCheck) Run(input *Input) []*Finding {
+
+	const fix = "use the protocol/port or protocol/min:max syntax, like tcp/443 or tcp/8000:8080"
+
+	findings := []*Finding{}
+
+	for _, netpol := range input.NetworkAccessPolicies {
+		for _, port := range netpol.Ports {
+			if err := intersection.ValidateProtocolPort(port); err != nil {
+				findings = append(findings, newPolicyFinding(c, SeverityError, netpol, fix, "invalid port '%s': %s", port, err))
+			}
+		}
+	}
+
+	for _, extnet := range input.ExternalNetworks {
+		for _, port := range extnet.ServicePorts {
+			if err := intersection.ValidateProtocolPort(port); err != nil {
+				findings = append(findings, newExternalNetworkFinding(c, SeverityError, extnet, fix, "invalid service port '%s': %s", port, err))
+			}
+		}
+	}
+
+	return findings
+}
+
+func containsFold(tags []string, tag string) bool {
+
+	for _, t := range tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,146 @@
+// Package lint checks network access policies and external networks for the problems
+// that prevent or alter their conversion to network rule set policies.
+package lint
+
+import (
+	"fmt"
+
+	"go.aporeto.io/gaia"
+)
+
+// Severity is the importance of a finding.
+type Severity string
+
+// Possible severities.
+const (
+	// SeverityError is a problem that fails the conversion or changes its result.
+	SeverityError Severity = "error"
+
+	// SeverityWarning is a problem that is converted as is but is likely a mistake.
+	SeverityWarning Severity = "warning"
+)
+
+// Finding is a problem found by a check in a policy or an external network.
+type Finding struct {
+	// Check is the name of the check that reported the finding.
+	Check string
+
+	Severity Severity
+
+	// Identity, Name and Namespace designate the object with the problem.
+	Identity  string
+	Name      string
+	Namespace string
+
+	Message string
+
+	// Fix is the suggested fix.
+	Fix string
+}
+
+func (f *Finding) String() string {
+	return fmt.Sprintf("%s: %s '%s' (namespace: '%s'): %s: %s. Fix: %s", f.Severity, f.Identity, f.Name, f.Namespace, f.Check, f.Message, f.Fix)
+}
+
+// Input holds the objects to check.
+type Input struct {
+	NetworkAccessPolicies gaia.NetworkAccessPoliciesList
+	ExternalNetworks      gaia.ExternalNetworksList
+}
+
+// Check is a check run over the input. Checks are independent from each other,
+// new checks can be added by implementing this interface.
+type Check interface {
+	// Name returns the name of the check, used to report and disable it.
+	Name() string
+
+	// Run returns the findings of the check.
+	Run(input *Input) []*Finding
+}
+
+// DefaultChecks returns the checks run by the lint command.
+func DefaultChecks() []Check {
+	return []Check{
+		namespaceOnlySubjectCheck{},
+		unsatisfiableClauseCheck{},
+		unknownSelectorCheck{},
+		missingExternalNetworkCheck{},
+		invalidPortCheck{},
+	}
+}
+
+// Disable returns the checks without the ones with the given names.
+// It returns an error if one of the names is not the name of a check.
+func Disable(checks []Check, names ...string) ([]Check, error) {
+
+	disabled := map[string]bool{}
+	for _, name := range names {
+		disabled[name] = false
+	}
+
+	out := []Check{}
+	for _, check := range checks {
+		if _, ok := disabled[check.Name()]; ok {
+			disabled[check.Name()] = true
+			continue
+		}
+		out = append(out, check)
+	}
+
+	for _, name := range names {
+		if !disabled[name] {
+			return nil, fmt.Errorf("unknown check '%s'", name)
+		}
+	}
+
+	return out, nil
+}
+
+// Run runs the checks over the input and returns their findings, in the order of the checks.
+func Run(input *Input, checks ...Check) []*Finding {
+
+	findings := []*Finding{}
+	for _, check := range checks {
+		findings = append(findings, check.Run(input)...)
+	}
+
+	return findings
+}
+
+// HasErrors returns true if one of the findings is an error.
+func HasErrors(findings []*Finding) bool {
+
+	for _, f := range findings {
+		if f.Severity == SeverityError {
+			return true
+		}
+	}
+
+	return false
+}
+
+// newPolicyFinding returns a new finding for a network access policy.
+func newPolicyFinding(check Check, severity Severity, netpol *gaia.NetworkAccessPolicy, fix string, format string, args ...interface{}) *Finding {
+	return &Finding{
+		Check:     check.Name(),
+		Severity:  severity,
+		Identity:  gaia.NetworkAccessPolicyIdentity.Name,
+		Name:      netpol.Name,
+		Namespace: netpol.Namespace,
+		Message:   fmt.Sprintf(format, args...),
+		Fix:       fix,
+	}
+}
+
+// newExternalNetworkFinding returns a new finding for an external network.
+func newExternalNetworkFinding(check Check, severity Severity, extnet *gaia.ExternalNetwork, fix string, format string, args ...interface{}) *Finding {
+	return &Finding{
+		Check:     check.Name(),
+		Severity:  severity,
+		Identity:  gaia.ExternalNetworkIdentity.Name,
+		Name:      extnet.Name,
+		Namespace: extnet.Namespace,
+		Message:   fmt.Sprintf(format, args...),
+		Fix:       fix,
+	}
+}
@@ -0,0 +1,93 @@
+package lint
+
+import (
+	"reflect"
+	"testing"
+
+	"go.aporeto.io/gaia"
+)
+
+func TestRun(t *testing.T) {
+
+	newPolicy := func(name string, subject [][]string, object [][]string, ports ...string) *gaia.NetworkAccessPolicy {
+		p := gaia.NewNetworkAccessPolicy()
+		p.Name = name
+		p.Namespace = "/ns"
+		p.Subject = subject
+		p.Object = object
+		p.Ports = ports
+		return p
+	}
+
+	input := &Input{
+		NetworkAccessPolicies: gaia.NetworkAccessPoliciesList{
+			newPolicy("valid", [][]string{{"app=a", "$namespace=/ns"}}, [][]string{{"ext=internet"}, {"$identity=externalnetwork", "$name=internet"}}, "tcp/443"),
+			newPolicy("namespace-only", [][]string{{"$namespace=/ns"}}, [][]string{{"app=b"}}),
+			newPolicy("unsatisfiable", [][]string{{"app=a"}, {}}, [][]string{{"$identity=processingunit", "$identity=externalnetwork"}}),
+			newPolicy("unknown-selector", [][]string{{"app=a"}}, [][]string{{"$identity=externalnetwork", "$id=x"}}),
+			newPolicy("processing-unit-selectors", [][]string{{"$image=nginx"}, {"$hostname=h", "$identity=processingunit"}}, [][]string{{"ext=internet"}}),
+			newPolicy("missing", [][]string{{"app=a"}}, [][]string{{"$identity=externalnetwork", "$name=intranet"}, {"$identity=externalnetwork", "$name=lab"}}),
+			newPolicy("invalid-port", [][]string{{"app=a"}}, [][]string{{"app=b"}}, "tcp/80", "tcp/80-90"),
+		},
+		ExternalNetworks: gaia.ExternalNetworksList{
+			{Name: "internet", AssociatedTags: []string{"ext=internet"}, ServicePorts: []string{"tcp/443", "udp/70000"}},
+			{Name: "lab", Namespace: "/other", AssociatedTags: []string{"ext=lab"}},
+		},
+	}
+
+	findings := Run(input, DefaultChecks()...)
+
+	type finding struct {
+		check    string
+		severity Severity
+		name     string
+	}
+
+	got := []finding{}
+	for _, f := range findings {
+		got = append(got, finding{f.Check, f.Severity, f.Name})
+		if f.Message == "" || f.Fix == "" {
+			t.Errorf("Run() finding without message or fix: %s", f)
+		}
+	}
+
+	want := []finding{
+		{"namespace-only-subject", SeverityWarning, "namespace-only"},
+		{"unsatisfiable-clause", SeverityWarning, "unsatisfiable"},
+		{"unsatisfiable-clause", SeverityWarning, "unsatisfiable"},
+		{"unknown-selector", SeverityError, "unknown-selector"},
+		{"missing-external-network", SeverityError, "missing"},
+		{"missing-external-network", SeverityError, "missing"},
+		{"invalid-port", SeverityError, "invalid-port"},
+		{"invalid-port", SeverityError, "internet"},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Run() = %v, want %v", got, want)
+	}
+
+	if !HasErrors(findings) {
+		t.Errorf("HasErrors() = false, want true")
+	}
+}
+
+func TestDisable(t *testing.T) {
+
+	checks, err := Disable(DefaultChecks(), "invalid-port", "namespace-only-subject")
+	if err != nil {
+		t.Fatalf("Disable() error = %v", err)
+	}
+
+	for _, check := range checks {
+		if check.Name() == "invalid-port" || check.Name() == "namespace-only-subject" {
+			t.Errorf("Disable() kept %s", check.Name())
+		}
+	}
+	if len(checks) != len(DefaultChecks())-2 {
+		t.Errorf("Disable() = %d checks, want %d", len(checks), len(DefaultChecks())-2)
+	}
+
+	if _, err := Disable(DefaultChecks(), "unknown"); err == nil {
+		t.Errorf("Disable() expected an error for an unknown check")
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Supported log formats.
+const (
+	logFormatConsole = "console"
+	logFormatJSON    = "json"
+)
+
+// logFlags holds the flags configuring the logger of a command.
+type logFlags struct {
+	level  *string
+	format *string
+}
+
+// addLogFlags adds the --log-level and --log-format flags to the flag set.
+func addLogFlags(fs *flag.FlagSet) *logFlags {
+	return &logFlags{
+		level:  fs.String("log-level", "info", "minimum level of the logs written to stderr: debug, info, warn or error (debug logs every conversion decision)"),
+		format: fs.String("log-format", logFormatConsole, "format of the logs: json or console"),
+	}
+}
+
+// newLogger returns the logger configured by the flags, writing to stderr.
+func (f *logFlags) newLogger() (*zap.Logger, error) {
+
+	var level zapcore.Level
+	if err := level.UnmarshalText([]byte(*f.level)); err != nil {
+		return nil, fmt.Errorf("invalid --log-level '%s': must be debug, info, warn or error", *f.level)
+	}
+
+	var config zap.Config
+	switch *f.format {
+	case logFormatConsole:
+		config = zap.NewDevelopmentConfig()
+	case logFormatJSON:
+		config = zap.NewProductionConfig()
+	default:
+		return nil, fmt.Errorf("invalid --log-format '%s': must be json or console", *f.format)
+	}
+
+	config.Level = zap.NewAtomicLevelAt(level)
+	config.Development = false
+	config.DisableStacktrace = true
+	config.Sampling = nil
+	config.OutputPaths = []string{"stderr"}
+	config.ErrorOutputPaths = []string{"stderr"}
+
+	return config.Build()
+}
@@ -1,18 +1,27 @@
 package main
 
 import (
-	"bufio"
 	"bytes"
 	"encoding/json"
 	"fmt"
 	"os"
 
-	"github.com/satyamsi/migrate/importyaml"
-	"github.com/satyamsi/migrate/rulesetpolicies"
 	"go.aporeto.io/elemental"
-	"go.aporeto.io/gaia"
 )
 
+const usage = `usage: migrate <command> [flags]
+
+Commands:
+  lint       check network access policies for problems before their conversion
+  convert    convert network access policies to network rule set policies
+  verify     check that converted rule sets take the same decisions as the policies
+  simulate   show the decision of the policies and converted rule sets for a flow
+  downgrade  convert network rule set policies back to network access policies
+  diff       show the policies and external networks that differ between two exports
+
+Run 'migrate <command> -h' for the flags of a command.
+`
+
 func o2str(obj interface{}) (string, error) {
 
 	var prettyJSON bytes.Buffer
@@ -28,103 +37,37 @@ func o2str(obj interface{}) (string, error) {
 	return prettyJSON.String(), err
 }
 
-func getEnterPress() {
-	fmt.Print("Press 'Enter' to continue...")
-	bufio.NewReader(os.Stdin).ReadBytes('\n')
-}
-
-func readYAML(filename string, verbose bool) (enl gaia.ExternalNetworksList, npl gaia.NetworkAccessPoliciesList) {
-
-	enl = gaia.ExternalNetworksList{}
-	npl = gaia.NetworkAccessPoliciesList{}
-
-	// Import external networks and network policies
-	if err := importyaml.ImportFromFile(filename, &enl, &npl); err != nil {
-		panic(err)
-	}
-
-	if verbose {
-		fmt.Printf("Imported %d External network objects:\n", len(enl))
-		s, err := o2str(enl)
-		if err == nil {
-			fmt.Println(s)
-		}
-
-		getEnterPress()
-
-		fmt.Printf("Imported %d Network policy objects:\n", len(npl))
-		s, err = o2str(npl)
-		if err == nil {
-			fmt.Println(s)
-		}
-
-		getEnterPress()
-	}
-
-	return
-}
-
 func main() {
 
-	verbose := false
-	enl, npl := readYAML("./input.yaml", verbose)
-
-	orl := gaia.NetworkRuleSetPoliciesList{}
-	enmap := map[string]*gaia.ExternalNetwork{}
-	// Actual conversion
-	for _, np := range npl {
-
-		fmt.Println("\n\n\nInput Network Policy:")
-		s, err := o2str(np)
-		if err == nil {
-			fmt.Println(s)
-		}
-
-		rsl, netl := rulesetpolicies.ConvertToNetworkRuleSetPolicies(np, enl)
-
-		fmt.Println("Output Ruleset Policy:")
-
-		s, err = o2str(rsl)
-		if err == nil {
-			fmt.Println(s)
-		}
-
-		orl = append(orl, rsl...)
-
-		if len(netl) != 0 {
-
-			fmt.Println("Output External Networks:")
-
-			s, err = o2str(netl)
-			if err == nil {
-				fmt.Println(s)
-			}
-
-			for _, net := range netl {
-				enmap[net.Name] = net
-			}
-		}
-
-		if verbose {
-			getEnterPress()
-		}
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
 	}
 
-	if verbose {
-		getEnterPress()
-
-		fmt.Println("Consolidated Ruleset Policies:")
-		s, err := o2str(orl)
-		if err == nil {
-			fmt.Println(s)
-		}
+	var err error
+	switch cmd := os.Args[1]; cmd {
+	case "lint":
+		err = runLint(os.Args[2:])
+	case "convert":
+		err = runConvert(os.Args[2:])
+	case "verify":
+		err = runVerify(os.Args[2:])
+	case "simulate":
+		err = runSimulate(os.Args[2:])
+	case "downgrade":
+		err = runDowngrade(os.Args[2:])
+	case "diff":
+		err = runDiff(os.Args[2:])
+	case "help", "-h", "--help":
+		fmt.Fprint(os.Stdout, usage)
+		return
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", cmd, usage)
+		os.Exit(2)
+	}
 
-		fmt.Println("Consolidated External Networks:")
-		for net := range enmap {
-			s, err = o2str(net)
-			if err == nil {
-				fmt.Println(s)
-			}
-		}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "error: %s\n", err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,137 @@
+package rulesetpolicies
+
+import (
+	"fmt"
+	"sort"
+
+	"go.aporeto.io/gaia"
+)
+
+// ExternalNetworkSet consolidates the v2 external networks produced by the
+// conversion of several network access policies. Every policy matching an
+// external network produces its own v2 copy of it; the set keeps a single
+// copy per external network and verifies that all the copies are identical.
+type ExternalNetworkSet struct {
+	ids      []string
+	networks map[string]*gaia.ExternalNetwork
+	sources  map[string]string
+}
+
+// NewExternalNetworkSet returns a new empty ExternalNetworkSet.
+func NewExternalNetworkSet() *ExternalNetworkSet {
+	return &ExternalNetworkSet{
+		networks: map[string]*gaia.ExternalNetwork{},
+		sources:  map[string]string{},
+	}
+}
+
+// Add merges the external networks produced by the conversion of the given policy.
+// External networks are identified by their namespace and name.
+// It returns an error wrapping ErrConflictingExternalNetwork without modifying
+// the set if one of the networks differs from a copy that is already in the set.
+// The copies of an external network are identical: they only differ when several
+// external networks share the same name in a namespace and the policies were
+// converted without CheckDuplicateExternalNetworks, which Add then detects.
+func (s *ExternalNetworkSet) Add(policy string, networks gaia.ExternalNetworksList) error {
+
+	pending := map[string]*gaia.ExternalNetwork{}
+
+	for _, network := range networks {
+
+		id := externalNetworkID(network)
+		existing, ok := s.networks[id]
+		source := s.sources[id]
+		if !ok {
+			existing, ok = pending[id]
+			source = policy
+		}
+
+		if !ok {
+			pending[id] = network
+			continue
+		}
+
+		if err := compareExternalNetworks(existing, network); err != nil {
+			if source == policy {
+				return fmt.Errorf("%w: copies of %s required by '%s' differ: %s", ErrConflictingExternalNetwork, quoteExternalNetwork(network), policy, err)
+			}
+			return fmt.Errorf("%w: copies of %s required by '%s' and '%s' differ: %s", ErrConflictingExternalNetwork, quoteExternalNetwork(network), source, policy, err)
+		}
+	}
+
+	for _, network := range networks {
+		id := externalNetworkID(network)
+		if n, ok := pending[id]; ok && n == network {
+			s.ids = append(s.ids, id)
+			s.networks[id] = network
+			s.sources[id] = policy
+		}
+	}
+
+	return nil
+}
+
+// List returns the consolidated external networks in the order they were first added.
+func (s *ExternalNetworkSet) List() gaia.ExternalNetworksList {
+
+	out := make(gaia.ExternalNetworksList, len(s.ids))
+	for i, id := range s.ids {
+		out[i] = s.networks[id]
+	}
+
+	return out
+}
+
+// WithUnconverted returns the consolidated external networks followed by the given external
+// networks that have no copy in the set, so an external network only appears once in the output
+// of a conversion: as its v2 copy if a policy selects it, unchanged otherwise.
+func (s *ExternalNetworkSet) WithUnconverted(networks gaia.ExternalNetworksList) gaia.ExternalNetworksList {
+
+	out := s.List()
+	for _, network := range networks {
+		if _, ok := s.networks[externalNetworkID(network)]; !ok {
+			out = append(out, network)
+		}
+	}
+
+	return out
+}
+
+// compareExternalNetworks returns an error describing the first difference between a and b.
+func compareExternalNetworks(a, b *gaia.ExternalNetwork) error {
+
+	if !equalStringSets(a.Entries, b.Entries) {
+		return fmt.Errorf("entries %v and %v", a.Entries, b.Entries)
+	}
+
+	if !equalStringSets(a.ServicePorts, b.ServicePorts) {
+		return fmt.Errorf("service ports %v and %v", a.ServicePorts, b.ServicePorts)
+	}
+
+	if !equalStringSets(a.AssociatedTags, b.AssociatedTags) {
+		return fmt.Errorf("tags %v and %v", a.AssociatedTags, b.AssociatedTags)
+	}
+
+	return nil
+}
+
+// equalStringSets returns true if a and b hold the same strings, regardless of their order.
+func equalStringSets(a, b []string) bool {
+
+	if len(a) != len(b) {
+		return false
+	}
+
+	sa := append([]string{}, a...)
+	sb := append([]string{}, b...)
+	sort.Strings(sa)
+	sort.Strings(sb)
+
+	for i := range sa {
+		if sa[i] != sb[i] {
+			return false
+		}
+	}
+
+	return true
+}
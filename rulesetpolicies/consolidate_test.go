@@ -0,0 +1,121 @@
+package rulesetpolicies
+
+import (
+	"errors"
+	"testing"
+
+	"go.aporeto.io/gaia"
+)
+
+func TestExternalNetworkSet(t *testing.T) {
+
+	newExtNet := func(name string, ports ...string) *gaia.ExternalNetwork {
+		return &gaia.ExternalNetwork{
+			Name:           name,
+			AssociatedTags: []string{"ext=" + name, "version=v2"},
+			Entries:        []string{"10.0.0.0/8"},
+			ServicePorts:   ports,
+		}
+	}
+
+	s := NewExternalNetworkSet()
+
+	if err := s.Add("p1", gaia.ExternalNetworksList{newExtNet("a", "tcp/80", "tcp/443"), newExtNet("a", "tcp/443", "tcp/80")}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	if err := s.Add("p2", gaia.ExternalNetworksList{newExtNet("b", "any"), newExtNet("a", "tcp/80", "tcp/443")}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	// Networks of the same name in different namespaces are different networks
+	other := newExtNet("a", "udp/53")
+	other.Namespace = "/other"
+	if err := s.Add("p4", gaia.ExternalNetworksList{other}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	got := s.List()
+	if len(got) != 3 || got[0].Name != "a" || got[1].Name != "b" || got[2].Namespace != "/other" {
+		t.Errorf("List() = %v, want [a b /other/a]", got)
+	}
+}
+
+func TestExternalNetworkSetConflicts(t *testing.T) {
+
+	newPolicy := func(name string, object string) *gaia.NetworkAccessPolicy {
+		netpol := gaia.NewNetworkAccessPolicy()
+		netpol.Name = name
+		netpol.Subject = [][]string{{"app=a"}}
+		netpol.Object = [][]string{{object}}
+		return netpol
+	}
+
+	// Two external networks with the same name, converted without checking the duplicates
+	extnets := gaia.ExternalNetworksList{
+		{Name: "x", AssociatedTags: []string{"ext=a"}, Entries: []string{"10.0.0.0/8"}},
+		{Name: "x", AssociatedTags: []string{"ext=b"}, Entries: []string{"10.0.0.0/16"}},
+	}
+
+	s := NewExternalNetworkSet()
+	for _, tt := range []struct {
+		netpol  *gaia.NetworkAccessPolicy
+		wantErr error
+	}{
+		{newPolicy("p1", "ext=a"), nil},
+		{newPolicy("p2", "ext=a"), nil},
+		{newPolicy("p3", "ext=b"), ErrConflictingExternalNetwork},
+	} {
+		_, netl, _, err := ConvertToNetworkRuleSetPolicies(tt.netpol, extnets, DefaultOptions())
+		if err != nil {
+			t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+		}
+		if err := s.Add(tt.netpol.Name, netl); !errors.Is(err, tt.wantErr) {
+			t.Errorf("Add(%s) error = %v, want %v", tt.netpol.Name, err, tt.wantErr)
+		}
+	}
+
+	if got := s.List(); len(got) != 1 || got[0].Entries[0] != "10.0.0.0/8" {
+		t.Errorf("List() = %v, want the copy of the first x", got)
+	}
+}
+
+func TestExternalNetworkSetWithUnconverted(t *testing.T) {
+
+	netpol := gaia.NewNetworkAccessPolicy()
+	netpol.Name = "p1"
+	netpol.Namespace = "/ns"
+	netpol.Subject = [][]string{{"app=a"}}
+	netpol.Object = [][]string{{"ext=a"}}
+	netpol.Ports = []string{"tcp/80"}
+
+	extnets := gaia.ExternalNetworksList{
+		{Name: "a", Namespace: "/ns", AssociatedTags: []string{"ext=a"}, Entries: []string{"10.0.0.0/8"}},
+		{Name: "b", Namespace: "/ns", AssociatedTags: []string{"ext=b"}, Entries: []string{"0.0.0.0/0"}},
+	}
+
+	_, netl, _, err := ConvertToNetworkRuleSetPolicies(netpol, extnets, DefaultOptions())
+	if err != nil {
+		t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+	}
+
+	s := NewExternalNetworkSet()
+	if err := s.Add(netpol.Name, netl); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+
+	got := s.WithUnconverted(extnets)
+
+	// The output of a conversion can be converted again
+	if err := CheckExternalNetworks(got); err != nil {
+		t.Fatalf("CheckExternalNetworks() error = %v", err)
+	}
+
+	if len(got) != 2 || got[0].Name != "a" || got[1] != extnets[1] {
+		t.Fatalf("WithUnconverted() = %v, want [a b]", got)
+	}
+
+	if !containsTag(got[0].AssociatedTags, DefaultMarkerTag) {
+		t.Errorf("WithUnconverted() = %v, want the v2 copy of a", got[0].AssociatedTags)
+	}
+}
@@ -0,0 +1,144 @@
+package rulesetpolicies
+
+import (
+	"sort"
+	"strings"
+	"time"
+
+	"go.aporeto.io/gaia"
+)
+
+// canonicalizePolicies puts the policies in a canonical form that does not
+// depend on the order of the input: the tags of every clause, the clauses,
+// the protocols and ports, the rules, the tags and the expanded rules recorded by
+// ExpandedRuleAnnotation are sorted and the timestamps are cleared. The time
+// annotations, which come from the input, are kept.
+func canonicalizePolicies(netpols gaia.NetworkRuleSetPoliciesList) {
+
+	for _, policy := range netpols {
+
+		policy.CreateTime = time.Time{}
+		policy.UpdateTime = time.Time{}
+
+		policy.Subject = canonicalClauses(policy.Subject)
+		policy.AssociatedTags = sortedStrings(policy.AssociatedTags)
+		policy.Metadata = sortedStrings(policy.Metadata)
+
+		for _, rule := range append(policy.IncomingRules, policy.OutgoingRules...) {
+			rule.Object = canonicalClauses(rule.Object)
+			rule.ProtocolPorts = sortedStrings(rule.ProtocolPorts)
+		}
+
+		sortRules(policy.IncomingRules)
+		sortRules(policy.OutgoingRules)
+
+		canonicalizeExpandedRules(policy)
+	}
+}
+
+// sortRules sorts the rules by object, action and protocols and ports.
+func sortRules(rules []*gaia.NetworkRule) {
+
+	sort.SliceStable(rules, func(i, j int) bool {
+		a, b := rules[i], rules[j]
+		if ka, kb := clausesKey(a.Object), clausesKey(b.Object); ka != kb {
+			return ka < kb
+		}
+		if a.Action != b.Action {
+			return a.Action < b.Action
+		}
+		return strings.Join(a.ProtocolPorts, "\x00") < strings.Join(b.ProtocolPorts, "\x00")
+	})
+}
+
+// canonicalizeExternalNetworks sorts the tags, entries and service ports of the external networks.
+func canonicalizeExternalNetworks(extnets gaia.ExternalNetworksList) {
+
+	for _, extnet := range extnets {
+		extnet.CreateTime = time.Time{}
+		extnet.UpdateTime = time.Time{}
+		extnet.AssociatedTags = sortedStrings(extnet.AssociatedTags)
+		extnet.Entries = sortedStrings(extnet.Entries)
+		extnet.ServicePorts = sortedStrings(extnet.ServicePorts)
+	}
+}
+
+// SortNetworkRuleSetPolicies sorts the policies by namespace, name and subject.
+func SortNetworkRuleSetPolicies(netpols gaia.NetworkRuleSetPoliciesList) {
+
+	sort.SliceStable(netpols, func(i, j int) bool {
+		a, b := netpols[i], netpols[j]
+		if a.Namespace != b.Namespace {
+			return a.Namespace < b.Namespace
+		}
+		if a.Name != b.Name {
+			return a.Name < b.Name
+		}
+		return clausesKey(a.Subject) < clausesKey(b.Subject)
+	})
+}
+
+// SortNetworkAccessPolicies sorts the policies by namespace and name.
+func SortNetworkAccessPolicies(netpols gaia.NetworkAccessPoliciesList) {
+
+	sort.SliceStable(netpols, func(i, j int) bool {
+		if netpols[i].Namespace != netpols[j].Namespace {
+			return netpols[i].Namespace < netpols[j].Namespace
+		}
+		return netpols[i].Name < netpols[j].Name
+	})
+}
+
+// SortExternalNetworks sorts the external networks by namespace and name.
+func SortExternalNetworks(extnets gaia.ExternalNetworksList) {
+
+	sort.SliceStable(extnets, func(i, j int) bool {
+		if extnets[i].Namespace != extnets[j].Namespace {
+			return extnets[i].Namespace < extnets[j].Namespace
+		}
+		return extnets[i].Name < extnets[j].Name
+	})
+}
+
+// canonicalClauses returns the clauses with their tags sorted, sorted by their tags.
+func canonicalClauses(clauses [][]string) [][]string {
+
+	if clauses == nil {
+		return nil
+	}
+
+	out := make([][]string, len(clauses))
+	for i, clause := range clauses {
+		out[i] = sortedStrings(clause)
+	}
+
+	sort.SliceStable(out, func(i, j int) bool {
+		return strings.Join(out[i], "\x00") < strings.Join(out[j], "\x00")
+	})
+
+	return out
+}
+
+// clausesKey returns a string identifying the clauses.
+func clausesKey(clauses [][]string) string {
+
+	parts := make([]string, len(clauses))
+	for i, clause := range clauses {
+		parts[i] = strings.Join(clause, "\x00")
+	}
+
+	return strings.Join(parts, "\x01")
+}
+
+// sortedStrings returns a sorted copy of the list.
+func sortedStrings(list []string) []string {
+
+	if list == nil {
+		return nil
+	}
+
+	out := append([]string{}, list...)
+	sort.Strings(out)
+
+	return out
+}
@@ -0,0 +1,447 @@
+package rulesetpolicies
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"go.aporeto.io/gaia"
+	"go.uber.org/zap"
+)
+
+// ConvertToNetworkAccessPolicies converts network rule set policies back to network access policies,
+// to roll back a migration. It is the opposite of ConvertToNetworkRuleSetPolicies:
+//
+//   - every rule gives a network access policy with the direction of the rule, the subject of the
+//     rule set policy and the object of the rule
+//   - the policies coming from the same rule set policy are merged back: the protocols and ports
+//     of the rules split by the multiport limit, the 'OR' clauses of the subject and object, and
+//     the incoming and outgoing policies with the same subject and object into bidirectional ones
+//   - the rules expanded against the external networks get back the object clause and the
+//     protocols and ports recorded by ExpandedRuleAnnotation, so the rules expanded from the
+//     same rule are merged back
+//   - the other rules marked with the ineffective tag match no traffic and are dropped with a warning
+//   - the rule set policies tagged for review get back the action recorded by ReviewActionAnnotation,
+//     Continue if there is none, and the rule set policies disabled by the conversion get back the
+//     disabled state recorded by DisabledAnnotation
+//   - the marker tag is removed from the other rules and the external networks, and the converted
+//     copies of the external networks are dropped when the original network is also present
+//   - the provenance annotations added by the Explain option are removed
+//   - the times recorded by CreateTimeAnnotation and UpdateTimeAnnotation are restored
+//
+// The options provide the marker and ineffective tags used by the conversion, and the logger.
+func ConvertToNetworkAccessPolicies(
+	netpols gaia.NetworkRuleSetPoliciesList,
+	extnets gaia.ExternalNetworksList,
+	opts Options,
+) (
+	outNetPolList gaia.NetworkAccessPoliciesList,
+	outExtNetList gaia.ExternalNetworksList,
+	warnings []*Warning,
+	err error,
+) {
+
+	outNetPolList = gaia.NetworkAccessPoliciesList{}
+	warnings = []*Warning{}
+
+	for _, policy := range netpols {
+
+		logger := opts.logger().With(zap.String("policy", policy.Name), zap.String("namespace", policy.Namespace))
+		logger.Debug("downgrading network rule set policy",
+			zap.Int("incomingRules", len(policy.IncomingRules)),
+			zap.Int("outgoingRules", len(policy.OutgoingRules)),
+		)
+
+		for _, rule := range policy.IncomingRules {
+			netpol, warning, err := downgradeRule(policy, rule, gaia.NetworkAccessPolicyApplyPolicyModeIncomingTraffic, opts)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			if warning != nil {
+				logger.Debug("rule dropped as ineffective", zap.Any("object", rule.Object))
+				warnings = append(warnings, warning)
+				continue
+			}
+			outNetPolList = append(outNetPolList, netpol)
+		}
+
+		for _, rule := range policy.OutgoingRules {
+			netpol, warning, err := downgradeRule(policy, rule, gaia.NetworkAccessPolicyApplyPolicyModeOutgoingTraffic, opts)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			if warning != nil {
+				logger.Debug("rule dropped as ineffective", zap.Any("object", rule.Object))
+				warnings = append(warnings, warning)
+				continue
+			}
+			outNetPolList = append(outNetPolList, netpol)
+		}
+	}
+
+	outNetPolList = mergeAccessPolicies(outNetPolList, portsMergeKey, mergePorts)
+	outNetPolList = mergeAccessPolicies(outNetPolList, objectMergeKey, mergeObjects)
+	outNetPolList = mergeAccessPolicies(outNetPolList, subjectMergeKey, mergeSubjects)
+	outNetPolList = mergeAccessPolicies(outNetPolList, directionMergeKey, mergeDirections)
+
+	outExtNetList = downgradeExternalNetworks(extnets, opts.MarkerTag)
+
+	opts.logger().Debug("downgraded network rule set policies",
+		zap.Int("networkAccessPolicies", len(outNetPolList)),
+		zap.Int("externalNetworks", len(outExtNetList)),
+	)
+
+	if opts.Deterministic {
+		SortNetworkAccessPolicies(outNetPolList)
+		canonicalizeExternalNetworks(outExtNetList)
+		SortExternalNetworks(outExtNetList)
+	}
+
+	return outNetPolList, outExtNetList, warnings, nil
+}
+
+// downgradeRule returns the network access policy equivalent to a rule of a rule set policy.
+// It returns a warning instead if the rule is marked as ineffective.
+func downgradeRule(
+	policy *gaia.NetworkRuleSetPolicy,
+	rule *gaia.NetworkRule,
+	mode gaia.NetworkAccessPolicyApplyPolicyModeValue,
+	opts Options,
+) (*gaia.NetworkAccessPolicy, *Warning, error) {
+
+	expanded := annotatedExpandedRules(policy)
+
+	object := [][]string{}
+	var ports []string
+	ineffective, restored := false, false
+	for _, clause := range rule.Object {
+
+		if opts.IneffectiveTag != "" && len(clause) == 1 && clause[0] == opts.IneffectiveTag {
+			ineffective = true
+			continue
+		}
+
+		// The clauses of the rules expanded against an external network, see ExpandedRuleAnnotation
+		if e, ok := expanded[expandedClauseKey(clause)]; ok {
+			object = append(object, append([]string{}, e.Source...))
+			ports, restored = e.Ports, true
+			continue
+		}
+
+		// The marker tag is only added to the clauses selecting external networks
+		if containsTag(clause, externalNetworkKey) {
+			clause = removeTag(clause, opts.MarkerTag)
+		}
+		object = append(object, append([]string{}, clause...))
+	}
+
+	// A restored rule is the rule of the network access policy, whatever the service ports
+	if ineffective && !restored {
+		return nil, newRuleSetWarning(policy, WarningIneffectiveRuleDropped, "rule to %v dropped: it matches no traffic", object), nil
+	}
+
+	netpol := gaia.NewNetworkAccessPolicy()
+	netpol.Name = policy.Name
+	netpol.Namespace = policy.Namespace
+	netpol.Description = policy.Description
+	netpol.Disabled = policy.Disabled
+	netpol.Protected = policy.Protected
+	netpol.Propagate = policy.Propagate
+	netpol.Fallback = policy.Fallback
+	netpol.AssociatedTags = append([]string{}, policy.AssociatedTags...)
+	netpol.Metadata = append([]string{}, policy.Metadata...)
+	netpol.Annotations = withoutExplanations(policy.Annotations)
+	netpol.Annotations = withoutAnnotation(netpol.Annotations, CreateTimeAnnotation)
+	netpol.Annotations = withoutAnnotation(netpol.Annotations, UpdateTimeAnnotation)
+	netpol.Annotations = withoutAnnotation(netpol.Annotations, ExpandedRuleAnnotation)
+	netpol.NormalizedTags = policy.NormalizedTags
+	netpol.CreateTime = annotatedTime(policy.Annotations, CreateTimeAnnotation, policy.CreateTime)
+	netpol.UpdateTime = annotatedTime(policy.Annotations, UpdateTimeAnnotation, policy.UpdateTime)
+
+	switch rule.Action {
+	case gaia.NetworkRuleActionAllow:
+		netpol.Action = gaia.NetworkAccessPolicyActionAllow
+	case gaia.NetworkRuleActionReject:
+		netpol.Action = gaia.NetworkAccessPolicyActionReject
+	default:
+		return nil, nil, fmt.Errorf("%w: rule action '%s' of rule set policy '%s'", ErrUnsupportedAction, rule.Action, policy.Name)
+	}
+
+	// Policies converted for review, see ContinueStrategyReview
+	if containsTag(policy.AssociatedTags, ReviewTag) {
+		netpol.Action = reviewAction(policy)
+		netpol.Disabled = false
+		netpol.AssociatedTags = removeTag(netpol.AssociatedTags, ReviewTag)
+		netpol.Annotations = withoutAnnotation(netpol.Annotations, ReviewActionAnnotation)
+	}
+
+	// Policies disabled by the conversion
+	if disabled, ok := annotatedDisabled(policy); ok {
+		netpol.Disabled = disabled
+		netpol.Annotations = withoutAnnotation(netpol.Annotations, DisabledAnnotation)
+	}
+
+	netpol.LogsEnabled = !rule.LogsDisabled
+	netpol.ObservationEnabled = rule.ObservationEnabled
+	netpol.ObservedTrafficAction = gaia.NetworkAccessPolicyObservedTrafficActionContinue
+	netpol.Ports = append([]string{}, rule.ProtocolPorts...)
+	if restored {
+		netpol.Ports = append([]string{}, ports...)
+	}
+	netpol.ApplyPolicyMode = mode
+
+	subject := make([][]string, len(policy.Subject))
+	for i, clause := range policy.Subject {
+		subject[i] = append([]string{}, clause...)
+	}
+
+	// Incoming rules apply to the traffic from their object to the subject of the rule set policy
+	netpol.Subject, netpol.Object = subject, object
+	if mode == gaia.NetworkAccessPolicyApplyPolicyModeIncomingTraffic {
+		netpol.Subject, netpol.Object = object, subject
+	}
+
+	return netpol, nil, nil
+}
+
+// downgradeExternalNetworks returns a copy of the external networks without the marker tag.
+// The output of the conversion replaces the original external networks by their converted
+// copies, which the marker is removed from. A converted copy is dropped if the input also
+// holds its original.
+func downgradeExternalNetworks(extnets gaia.ExternalNetworksList, markerTag string) gaia.ExternalNetworksList {
+
+	originals := map[string]struct{}{}
+	for _, extnet := range extnets {
+		if markerTag != "" && !containsTag(extnet.AssociatedTags, markerTag) {
+			originals[externalNetworkID(extnet)] = struct{}{}
+		}
+	}
+
+	out := gaia.ExternalNetworksList{}
+	seen := map[string]struct{}{}
+	for _, extnet := range extnets {
+
+		id := externalNetworkID(extnet)
+		if _, ok := seen[id]; ok {
+			continue
+		}
+
+		_, original := originals[id]
+		if original && containsTag(extnet.AssociatedTags, markerTag) {
+			continue
+		}
+		seen[id] = struct{}{}
+
+		extnet = extnet.DeepCopy()
+		extnet.AssociatedTags = removeTag(extnet.AssociatedTags, markerTag)
+		extnet.NormalizedTags = removeTag(extnet.NormalizedTags, markerTag)
+		out = append(out, extnet)
+	}
+
+	return out
+}
+
+// newRuleSetWarning returns a new warning for the given rule set policy.
+func newRuleSetWarning(policy *gaia.NetworkRuleSetPolicy, code WarningCode, format string, args ...interface{}) *Warning {
+	return &Warning{
+		ID:        policy.ID,
+		Name:      policy.Name,
+		Namespace: policy.Namespace,
+		Code:      code,
+		Message:   fmt.Sprintf(format, args...),
+	}
+}
+
+// mergeAccessPolicies merges the policies with the same key. The merge function merges a policy
+// into the first policy of its group and returns false if they cannot be merged.
+func mergeAccessPolicies(
+	netpols gaia.NetworkAccessPoliciesList,
+	key func(*gaia.NetworkAccessPolicy) string,
+	merge func(into *gaia.NetworkAccessPolicy, netpol *gaia.NetworkAccessPolicy) bool,
+) gaia.NetworkAccessPoliciesList {
+
+	out := gaia.NetworkAccessPoliciesList{}
+	groups := map[string]int{}
+
+	for _, netpol := range netpols {
+
+		k := key(netpol)
+		if i, ok := groups[k]; ok && merge(out[i], netpol) {
+			continue
+		}
+
+		groups[k] = len(out)
+		out = append(out, netpol)
+	}
+
+	return out
+}
+
+// accessPolicyKey returns a key identifying the policies coming from the same network access policy,
+// followed by the given parts.
+func accessPolicyKey(netpol *gaia.NetworkAccessPolicy, parts ...string) string {
+
+	annotations := []string{}
+	for _, k := range sortedStrings(annotationKeys(netpol.Annotations)) {
+		annotations = append(annotations, k+"="+strings.Join(netpol.Annotations[k], "\x00"))
+	}
+
+	return strings.Join(append([]string{
+		netpol.Namespace,
+		netpol.Name,
+		netpol.Description,
+		string(netpol.Action),
+		strings.Join(sortedStrings(netpol.AssociatedTags), "\x00"),
+		strings.Join(sortedStrings(netpol.Metadata), "\x00"),
+		strings.Join(annotations, "\x00"),
+		fmt.Sprintf("%t %t %t %t %t %t", netpol.Disabled, netpol.Fallback, netpol.Propagate, netpol.Protected, netpol.LogsEnabled, netpol.ObservationEnabled),
+	}, parts...), "\x02")
+}
+
+func portsMergeKey(netpol *gaia.NetworkAccessPolicy) string {
+	return accessPolicyKey(netpol, string(netpol.ApplyPolicyMode), clausesKey(canonicalClauses(netpol.Subject)), clausesKey(canonicalClauses(netpol.Object)))
+}
+
+func objectMergeKey(netpol *gaia.NetworkAccessPolicy) string {
+	return accessPolicyKey(netpol, string(netpol.ApplyPolicyMode), clausesKey(canonicalClauses(netpol.Subject)), portsKey(netpol.Ports))
+}
+
+func subjectMergeKey(netpol *gaia.NetworkAccessPolicy) string {
+	return accessPolicyKey(netpol, string(netpol.ApplyPolicyMode), clausesKey(canonicalClauses(netpol.Object)), portsKey(netpol.Ports))
+}
+
+func directionMergeKey(netpol *gaia.NetworkAccessPolicy) string {
+	return accessPolicyKey(netpol, clausesKey(canonicalClauses(netpol.Subject)), clausesKey(canonicalClauses(netpol.Object)), portsKey(netpol.Ports))
+}
+
+func portsKey(ports []string) string {
+	return strings.Join(sortedStrings(ports), "\x00")
+}
+
+// mergePorts merges the protocols and ports of the rules split by the multiport limit.
+// No protocols and ports means any.
+func mergePorts(into *gaia.NetworkAccessPolicy, netpol *gaia.NetworkAccessPolicy) bool {
+
+	if len(into.Ports) == 0 || len(netpol.Ports) == 0 {
+		into.Ports = []string{}
+		return true
+	}
+
+	for _, port := range netpol.Ports {
+		into.Ports = appendMissingString(into.Ports, port)
+	}
+
+	return true
+}
+
+func mergeObjects(into *gaia.NetworkAccessPolicy, netpol *gaia.NetworkAccessPolicy) bool {
+	into.Object = appendMissingClauses(into.Object, netpol.Object)
+	return true
+}
+
+func mergeSubjects(into *gaia.NetworkAccessPolicy, netpol *gaia.NetworkAccessPolicy) bool {
+	into.Subject = appendMissingClauses(into.Subject, netpol.Subject)
+	return true
+}
+
+// mergeDirections merges an incoming and an outgoing policy into a bidirectional one.
+func mergeDirections(into *gaia.NetworkAccessPolicy, netpol *gaia.NetworkAccessPolicy) bool {
+
+	if into.ApplyPolicyMode == gaia.NetworkAccessPolicyApplyPolicyModeBidirectional ||
+		netpol.ApplyPolicyMode == gaia.NetworkAccessPolicyApplyPolicyModeBidirectional ||
+		into.ApplyPolicyMode == netpol.ApplyPolicyMode {
+		return false
+	}
+
+	into.ApplyPolicyMode = gaia.NetworkAccessPolicyApplyPolicyModeBidirectional
+	return true
+}
+
+// appendMissingClauses appends the clauses that are not already in the list, regardless of the order of their tags.
+func appendMissingClauses(clauses [][]string, others [][]string) [][]string {
+
+	keys := map[string]struct{}{}
+	for _, clause := range clauses {
+		keys[strings.Join(sortedStrings(clause), "\x00")] = struct{}{}
+	}
+
+	for _, clause := range others {
+		k := strings.Join(sortedStrings(clause), "\x00")
+		if _, ok := keys[k]; ok {
+			continue
+		}
+		keys[k] = struct{}{}
+		clauses = append(clauses, clause)
+	}
+
+	return clauses
+}
+
+// reviewAction returns the action of the network access policy a rule set policy tagged for
+// review comes from, see ReviewActionAnnotation.
+func reviewAction(policy *gaia.NetworkRuleSetPolicy) gaia.NetworkAccessPolicyActionValue {
+
+	values := policy.Annotations[ReviewActionAnnotation]
+	if len(values) != 1 {
+		return gaia.NetworkAccessPolicyActionContinue
+	}
+
+	return gaia.NetworkAccessPolicyActionValue(values[0])
+}
+
+// annotatedDisabled returns whether the network access policy a rule set policy disabled by
+// the conversion comes from was disabled, see DisabledAnnotation. It returns false for ok if
+// the conversion did not disable the rule set policy.
+func annotatedDisabled(policy *gaia.NetworkRuleSetPolicy) (disabled bool, ok bool) {
+
+	values := policy.Annotations[DisabledAnnotation]
+	if len(values) != 1 {
+		return false, false
+	}
+
+	disabled, err := strconv.ParseBool(values[0])
+	if err != nil {
+		return false, false
+	}
+
+	return disabled, true
+}
+
+// withoutAnnotation returns a copy of the annotations without the given key, or nil
+// if there are no other annotations.
+func withoutAnnotation(annotations map[string][]string, key string) map[string][]string {
+
+	if _, ok := annotations[key]; !ok {
+		return annotations
+	}
+
+	var out map[string][]string
+	for k, v := range annotations {
+		if k == key {
+			continue
+		}
+		if out == nil {
+			out = map[string][]string{}
+		}
+		out[k] = v
+	}
+
+	return out
+}
+
+// removeTag returns a copy of the tags without the given tag.
+func removeTag(tags []string, tag string) []string {
+
+	if tags == nil {
+		return nil
+	}
+
+	out := []string{}
+	for _, t := range tags {
+		if tag == "" || t != tag {
+			out = append(out, t)
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,179 @@
+package rulesetpolicies
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/satyamsi/migrate/diff"
+	"github.com/satyamsi/migrate/importyaml"
+	"go.aporeto.io/gaia"
+	"go.uber.org/zap"
+)
+
+func TestConvertToNetworkAccessPolicies(t *testing.T) {
+
+	extnets := gaia.ExternalNetworksList{
+		{Name: "e1", AssociatedTags: []string{"ext=web"}, ServicePorts: []string{"tcp/443"}},
+		{Name: "e2", AssociatedTags: []string{"ext=ssh"}, ServicePorts: []string{"tcp/22"}},
+	}
+
+	np1 := gaia.NewNetworkAccessPolicy()
+	np1.Name = "np1"
+	np1.Namespace = "/ns"
+	np1.Subject = [][]string{{"app=a"}, {"app=b", "env=prod"}}
+	np1.Object = [][]string{{"app=c"}, {"app=d"}}
+	np1.Ports = []string{"tcp/1", "tcp/2", "tcp/3", "udp/53"}
+	np1.LogsEnabled = true
+
+	np2 := gaia.NewNetworkAccessPolicy()
+	np2.Name = "np2"
+	np2.Namespace = "/ns"
+	np2.ApplyPolicyMode = gaia.NetworkAccessPolicyApplyPolicyModeOutgoingTraffic
+	np2.Subject = [][]string{{"app=a"}}
+	np2.Object = [][]string{{"ext=web"}, {"ext=ssh"}}
+	np2.Ports = []string{"tcp/443"}
+
+	np3 := gaia.NewNetworkAccessPolicy()
+	np3.Name = "np3"
+	np3.Namespace = "/ns"
+	np3.Action = gaia.NetworkAccessPolicyActionContinue
+	np3.Disabled = true
+	np3.ApplyPolicyMode = gaia.NetworkAccessPolicyApplyPolicyModeIncomingTraffic
+	np3.Subject = [][]string{{"app=a"}}
+	np3.Object = [][]string{{"app=b"}}
+
+	opts := DefaultOptions()
+	opts.MultiportLimit = 2
+	opts.ContinueStrategy = ContinueStrategyReview
+
+	rsl := gaia.NetworkRuleSetPoliciesList{}
+	converted := NewExternalNetworkSet()
+	for _, np := range []*gaia.NetworkAccessPolicy{np1, np2, np3} {
+		out, netl, _, err := ConvertToNetworkRuleSetPolicies(np, extnets, opts)
+		if err != nil {
+			t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+		}
+		if err := converted.Add(np.Name, netl); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+		rsl = append(rsl, out...)
+	}
+
+	// The output of the conversion holds the converted external networks
+	npl, enl, warnings, err := ConvertToNetworkAccessPolicies(rsl, converted.WithUnconverted(extnets), opts)
+	if err != nil {
+		t.Fatalf("ConvertToNetworkAccessPolicies() error = %v", err)
+	}
+
+	if len(npl) != 3 {
+		t.Fatalf("ConvertToNetworkAccessPolicies() = %d policies, want 3: %v", len(npl), npl)
+	}
+
+	got := npl[0]
+	if got.Name != "np1" || got.ApplyPolicyMode != gaia.NetworkAccessPolicyApplyPolicyModeBidirectional || !got.LogsEnabled {
+		t.Errorf("ConvertToNetworkAccessPolicies() = %v, want bidirectional np1 with logs", got)
+	}
+	if !matchObjects(np1.Subject, got.Subject) || !matchObjects(np1.Object, got.Object) {
+		t.Errorf("ConvertToNetworkAccessPolicies() subject = %v, object = %v, want %v, %v", got.Subject, got.Object, np1.Subject, np1.Object)
+	}
+	if !reflect.DeepEqual(sortedStrings(got.Ports), sortedStrings(np1.Ports)) {
+		t.Errorf("ConvertToNetworkAccessPolicies() ports = %v, want %v", got.Ports, np1.Ports)
+	}
+
+	// The rules expanded against e1 and e2 are restored, even though the rule to e2 is ineffective
+	got = npl[1]
+	if got.Name != "np2" || got.ApplyPolicyMode != gaia.NetworkAccessPolicyApplyPolicyModeOutgoingTraffic || !matchObjects(np2.Object, got.Object) {
+		t.Errorf("ConvertToNetworkAccessPolicies() = %v, want outgoing np2 to %v", got, np2.Object)
+	}
+	if !reflect.DeepEqual(got.Ports, np2.Ports) || got.Annotations != nil {
+		t.Errorf("ConvertToNetworkAccessPolicies() ports = %v, annotations = %v, want %v without annotations", got.Ports, got.Annotations, np2.Ports)
+	}
+	if len(warnings) != 0 {
+		t.Errorf("ConvertToNetworkAccessPolicies() warnings = %v, want none", warnings)
+	}
+
+	got = npl[2]
+	if got.Name != "np3" || got.Action != gaia.NetworkAccessPolicyActionContinue || !got.Disabled || containsTag(got.AssociatedTags, ReviewTag) {
+		t.Errorf("ConvertToNetworkAccessPolicies() = %v, want disabled np3 with the Continue action", got)
+	}
+	if got.Annotations != nil {
+		t.Errorf("ConvertToNetworkAccessPolicies() annotations = %v, want none", got.Annotations)
+	}
+
+	if len(enl) != 2 {
+		t.Fatalf("ConvertToNetworkAccessPolicies() external networks = %v, want 2", enl)
+	}
+	for i, extnet := range enl {
+		if !reflect.DeepEqual(extnet.AssociatedTags, extnets[i].AssociatedTags) {
+			t.Errorf("ConvertToNetworkAccessPolicies() external network tags = %v, want %v", extnet.AssociatedTags, extnets[i].AssociatedTags)
+		}
+	}
+}
+
+func TestConvertToNetworkAccessPoliciesUnrecorded(t *testing.T) {
+
+	// A rule set policy without the expanded rules recorded by the conversion
+	policy := gaia.NewNetworkRuleSetPolicy()
+	policy.Name = "name"
+	policy.Namespace = "/ns"
+	policy.Subject = [][]string{{"app=a"}}
+	policy.OutgoingRules = []*gaia.NetworkRule{
+		{Action: gaia.NetworkRuleActionAllow, Object: [][]string{{"ext=web", externalNetworkKey, "$name=e1", DefaultMarkerTag}}, ProtocolPorts: []string{"tcp/443"}},
+		{Action: gaia.NetworkRuleActionAllow, Object: [][]string{{"ext=ssh", externalNetworkKey, "$name=e2", DefaultMarkerTag}, {DefaultIneffectiveTag}}},
+	}
+
+	npl, _, warnings, err := ConvertToNetworkAccessPolicies(gaia.NetworkRuleSetPoliciesList{policy}, nil, DefaultOptions())
+	if err != nil {
+		t.Fatalf("ConvertToNetworkAccessPolicies() error = %v", err)
+	}
+
+	// Only the marker tag is removed
+	want := [][]string{{"ext=web", externalNetworkKey, "$name=e1"}}
+	if len(npl) != 1 || !matchObjects(want, npl[0].Object) || !reflect.DeepEqual(npl[0].Ports, []string{"tcp/443"}) {
+		t.Errorf("ConvertToNetworkAccessPolicies() = %v, want a policy to %v", npl, want)
+	}
+
+	if len(warnings) != 1 || warnings[0].Code != WarningIneffectiveRuleDropped || warnings[0].Name != "name" {
+		t.Errorf("ConvertToNetworkAccessPolicies() warnings = %v, want the ineffective rule", warnings)
+	}
+}
+
+func TestConvertToNetworkAccessPoliciesRoundTrip(t *testing.T) {
+
+	bundle, err := importyaml.ImportFromFile("../input.yaml", zap.NewNop())
+	if err != nil {
+		t.Fatalf("ImportFromFile() error = %v", err)
+	}
+
+	opts := DefaultOptions()
+
+	rsl := gaia.NetworkRuleSetPoliciesList{}
+	converted := NewExternalNetworkSet()
+	for _, np := range bundle.NetworkAccessPolicies() {
+		out, netl, _, err := ConvertToNetworkRuleSetPolicies(np, bundle.ExternalNetworks(), opts)
+		if err != nil {
+			t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+		}
+		if err := converted.Add(np.Name, netl); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+		rsl = append(rsl, out...)
+	}
+
+	npl, enl, _, err := ConvertToNetworkAccessPolicies(rsl, converted.WithUnconverted(bundle.ExternalNetworks()), opts)
+	if err != nil {
+		t.Fatalf("ConvertToNetworkAccessPolicies() error = %v", err)
+	}
+
+	downgraded := importyaml.NewBundle()
+	for _, np := range npl {
+		downgraded.Add(np)
+	}
+	for _, extnet := range enl {
+		downgraded.Add(extnet)
+	}
+
+	if changes := diff.Compare(bundle, downgraded); len(changes) != 0 {
+		t.Errorf("ConvertToNetworkAccessPolicies() changes = %v, want none", changes)
+	}
+}
@@ -0,0 +1,52 @@
+package rulesetpolicies
+
+import (
+	"errors"
+	"fmt"
+
+	"go.aporeto.io/gaia"
+)
+
+var (
+	// ErrDuplicateName is returned when two external networks share the same name.
+	ErrDuplicateName = errors.New("duplicate external network name")
+
+	// ErrUnsupportedAction is returned when a network access policy action has no network rule equivalent.
+	ErrUnsupportedAction = errors.New("unsupported network access policy action")
+
+	// ErrConflictingExternalNetwork is returned when two policies require different v2 copies of the same external network.
+	ErrConflictingExternalNetwork = errors.New("conflicting external network")
+
+	// ErrUnknownTag is returned when a policy uses a tag that cannot be matched against external networks.
+	ErrUnknownTag = errors.New("unknown tag")
+
+	// ErrInvalidPort is returned in strict mode when a policy or an external network it selects has a port that cannot be parsed.
+	ErrInvalidPort = errors.New("invalid port")
+)
+
+// PolicyError is the error returned when a network access policy cannot be converted.
+type PolicyError struct {
+	ID        string
+	Name      string
+	Namespace string
+	Err       error
+}
+
+// NewPolicyError returns a new PolicyError for the given policy.
+func NewPolicyError(netpol *gaia.NetworkAccessPolicy, err error) *PolicyError {
+	return &PolicyError{
+		ID:        netpol.ID,
+		Name:      netpol.Name,
+		Namespace: netpol.Namespace,
+		Err:       err,
+	}
+}
+
+func (e *PolicyError) Error() string {
+	return fmt.Sprintf("unable to convert network access policy '%s': %s", e.Name, e.Err)
+}
+
+// Unwrap returns the underlying error.
+func (e *PolicyError) Unwrap() error {
+	return e.Err
+}
@@ -0,0 +1,103 @@
+package rulesetpolicies
+
+import (
+	"encoding/json"
+
+	"go.aporeto.io/gaia"
+)
+
+// ExpandedRuleAnnotation holds the rules of a rule set policy expanded against the external
+// networks they select, so the downgrade can restore the rules they come from. Each value is
+// a JSON object holding the object clause of an expanded rule, the clause it comes from and
+// the protocols and ports of the rule before their intersection with the service ports, like
+// '{"object":["ext=web","$identity=externalnetwork","$name=web","version=v2"],"source":["ext=web"],"ports":["tcp/443"]}'.
+// A merged rule set policy holds the values of every merged policy.
+const ExpandedRuleAnnotation = "migration:expanded"
+
+// expandedRule records the object clause of a rule expanded against an external network,
+// the clause it comes from and the protocols and ports of the rule before the expansion.
+type expandedRule struct {
+	Object []string `json:"object"`
+	Source []string `json:"source"`
+	Ports  []string `json:"ports"`
+}
+
+// annotateExpandedRules adds the expanded rules to the annotation of a rule set policy,
+// on a copy of its annotations.
+func annotateExpandedRules(policy *gaia.NetworkRuleSetPolicy, expanded []expandedRule) {
+
+	if len(expanded) == 0 {
+		return
+	}
+
+	values := append([]string{}, policy.Annotations[ExpandedRuleAnnotation]...)
+	for _, rule := range expanded {
+		// Lists of strings always marshal
+		data, _ := json.Marshal(rule)
+		values = appendMissingString(values, string(data))
+	}
+
+	setAnnotation(policy, ExpandedRuleAnnotation, values...)
+}
+
+// annotatedExpandedRules returns the expanded rules recorded by the annotation of a rule set
+// policy, by object clause, see expandedClauseKey. The values that cannot be parsed are ignored.
+func annotatedExpandedRules(policy *gaia.NetworkRuleSetPolicy) map[string]expandedRule {
+
+	out := map[string]expandedRule{}
+	for _, value := range policy.Annotations[ExpandedRuleAnnotation] {
+
+		var rule expandedRule
+		if err := json.Unmarshal([]byte(value), &rule); err != nil {
+			continue
+		}
+
+		out[expandedClauseKey(rule.Object)] = rule
+	}
+
+	return out
+}
+
+// expandedClauseKey returns the key of an object clause, regardless of the order of its tags.
+func expandedClauseKey(clause []string) string {
+	return clausesKey(canonicalClauses([][]string{clause}))
+}
+
+// canonicalizeExpandedRules sorts the tags, the protocols and ports and the values of the
+// annotation of a rule set policy, on a copy of its annotations.
+func canonicalizeExpandedRules(policy *gaia.NetworkRuleSetPolicy) {
+
+	if _, ok := policy.Annotations[ExpandedRuleAnnotation]; !ok {
+		return
+	}
+
+	expanded := annotatedExpandedRules(policy)
+	values := make([]string, 0, len(expanded))
+	for _, rule := range expanded {
+		rule.Object = sortedStrings(rule.Object)
+		rule.Source = sortedStrings(rule.Source)
+		rule.Ports = sortedStrings(rule.Ports)
+		data, _ := json.Marshal(rule)
+		values = append(values, string(data))
+	}
+
+	setAnnotation(policy, ExpandedRuleAnnotation, sortedStrings(values)...)
+}
+
+// mergeExpandedRules sets the expanded rules of the policies of its group on a merged
+// rule set policy.
+func mergeExpandedRules(merged *gaia.NetworkRuleSetPolicy, group []*gaia.NetworkRuleSetPolicy) {
+
+	values := []string{}
+	for _, policy := range group {
+		for _, value := range policy.Annotations[ExpandedRuleAnnotation] {
+			values = appendMissingString(values, value)
+		}
+	}
+
+	if len(values) == 0 {
+		return
+	}
+
+	setAnnotation(merged, ExpandedRuleAnnotation, values...)
+}
@@ -0,0 +1,214 @@
+package rulesetpolicies
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.aporeto.io/gaia"
+)
+
+// Annotations added by the Explain option.
+const (
+	// ExplainAnnotation holds the provenance of a rule set policy: the name and ID of the
+	// network access policy it comes from and the 'OR' clause of that policy its subject
+	// comes from, like 'source=name; subject=object[1]' for an incoming rule set policy.
+	// A merged rule set policy holds one value per merged policy.
+	ExplainAnnotation = "migration:explain"
+
+	// ExplainRuleAnnotationPrefix followed by the direction and the index of a rule, like
+	// 'migration:explain:incoming:0', holds the provenance of the rule: the policy and the
+	// 'OR' clause its object comes from, like 'object=subject[0]', and for the rules selecting
+	// an external network, the network it was expanded against and the ports before and after
+	// the intersection with its service ports. A rule of a merged rule set policy holds one
+	// value per merged rule.
+	ExplainRuleAnnotationPrefix = ExplainAnnotation + ":"
+)
+
+// Directions of the rules in the annotation keys.
+const (
+	explainIncoming = "incoming"
+	explainOutgoing = "outgoing"
+)
+
+// provenance records where the generated rules come from, as a list of 'key=value'
+// parts, see Options.Explain. A nil provenance records nothing.
+type provenance map[*gaia.NetworkRule][]string
+
+// add appends values to the provenance of the rule.
+func (p provenance) add(rule *gaia.NetworkRule, values ...string) {
+
+	if p == nil {
+		return
+	}
+
+	p[rule] = append(p[rule], values...)
+}
+
+// derive gives to a rule derived from another one the provenance of the other rule,
+// followed by the given values.
+func (p provenance) derive(from *gaia.NetworkRule, to *gaia.NetworkRule, values ...string) {
+
+	if p == nil {
+		return
+	}
+
+	p[to] = append(append([]string{}, p[from]...), values...)
+}
+
+// annotate sets the annotation of each rule of the policies that has a provenance.
+// It must be called once the rules are in their final order.
+func (p provenance) annotate(netpols gaia.NetworkRuleSetPoliciesList) {
+
+	if p == nil {
+		return
+	}
+
+	for _, policy := range netpols {
+		for i, rule := range policy.IncomingRules {
+			if values, ok := p[rule]; ok {
+				policy.Annotations[explainRuleKey(explainIncoming, i)] = []string{explainValue(values)}
+			}
+		}
+		for i, rule := range policy.OutgoingRules {
+			if values, ok := p[rule]; ok {
+				policy.Annotations[explainRuleKey(explainOutgoing, i)] = []string{explainValue(values)}
+			}
+		}
+	}
+}
+
+// explainSource returns the provenance values designating the network access policy.
+func explainSource(netpol *gaia.NetworkAccessPolicy) []string {
+
+	values := []string{"source=" + netpol.Name}
+	if netpol.ID != "" {
+		values = append(values, "sourceID="+netpol.ID)
+	}
+
+	return values
+}
+
+// explainPolicy sets the provenance annotation of a rule set policy, on a copy of its annotations.
+func explainPolicy(policy *gaia.NetworkRuleSetPolicy, values ...string) {
+	setAnnotation(policy, ExplainAnnotation, explainValue(values))
+}
+
+// explainValue joins the parts of a provenance into an annotation value.
+func explainValue(values []string) string {
+	return strings.Join(values, "; ")
+}
+
+// explainClause returns the provenance value of an 'OR' clause of a network access policy.
+func explainClause(key string, side string, index int) string {
+	return fmt.Sprintf("%s=%s[%d]", key, side, index)
+}
+
+// explainPorts returns the provenance value of a list of protocols and ports.
+func explainPorts(key string, ports []string) string {
+
+	if len(ports) == 0 {
+		return key + "=none"
+	}
+
+	return key + "=" + strings.Join(ports, " ")
+}
+
+func explainRuleKey(direction string, index int) string {
+	return fmt.Sprintf("%s%s:%d", ExplainRuleAnnotationPrefix, direction, index)
+}
+
+func isExplainAnnotation(key string) bool {
+	return key == ExplainAnnotation || strings.HasPrefix(key, ExplainRuleAnnotationPrefix)
+}
+
+// withoutExplanations returns the annotations without the ones added by the Explain option,
+// or nil if there are no other annotations.
+func withoutExplanations(annotations map[string][]string) map[string][]string {
+
+	found := false
+	for k := range annotations {
+		if isExplainAnnotation(k) {
+			found = true
+			break
+		}
+	}
+
+	if !found {
+		return annotations
+	}
+
+	var out map[string][]string
+	for k, v := range annotations {
+		if isExplainAnnotation(k) {
+			continue
+		}
+		if out == nil {
+			out = map[string][]string{}
+		}
+		out[k] = v
+	}
+
+	return out
+}
+
+// mergeExplanations sets the provenance annotations of a merged rule set policy from the
+// ones of the policies of its group: the provenance of the policies is joined and the
+// provenance of each rule is moved to the index of the rule in the merged policy.
+func mergeExplanations(merged *gaia.NetworkRuleSetPolicy, group []*gaia.NetworkRuleSetPolicy) {
+
+	explained := false
+	for _, policy := range group {
+		if _, ok := policy.Annotations[ExplainAnnotation]; ok {
+			explained = true
+			break
+		}
+	}
+
+	if !explained {
+		return
+	}
+
+	// The annotations of the merged policy are shared with the first policy of the group
+	annotations := map[string][]string{}
+	for k, v := range merged.Annotations {
+		if !isExplainAnnotation(k) {
+			annotations[k] = v
+		}
+	}
+
+	appendValues := func(key string, values []string) {
+		for _, v := range values {
+			annotations[key] = appendMissingString(annotations[key], v)
+		}
+	}
+
+	for _, policy := range group {
+
+		appendValues(ExplainAnnotation, policy.Annotations[ExplainAnnotation])
+
+		for _, direction := range []struct {
+			name   string
+			rules  []*gaia.NetworkRule
+			merged []*gaia.NetworkRule
+		}{
+			{explainIncoming, policy.IncomingRules, merged.IncomingRules},
+			{explainOutgoing, policy.OutgoingRules, merged.OutgoingRules},
+		} {
+			for i, rule := range direction.rules {
+				values, ok := policy.Annotations[explainRuleKey(direction.name, i)]
+				if !ok {
+					continue
+				}
+				for j, m := range direction.merged {
+					if reflect.DeepEqual(rule, m) {
+						appendValues(explainRuleKey(direction.name, j), values)
+						break
+					}
+				}
+			}
+		}
+	}
+
+	merged.Annotations = annotations
+}
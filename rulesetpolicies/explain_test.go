@@ -0,0 +1,149 @@
+package rulesetpolicies
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.aporeto.io/gaia"
+)
+
+func TestConvertToNetworkRuleSetPoliciesExplain(t *testing.T) {
+
+	netpol := gaia.NewNetworkAccessPolicy()
+	netpol.ID = "id1"
+	netpol.Name = "name"
+	netpol.Namespace = "namespace"
+	netpol.ApplyPolicyMode = gaia.NetworkAccessPolicyApplyPolicyModeOutgoingTraffic
+	netpol.Subject = [][]string{{"app=foo"}}
+	netpol.Object = [][]string{{"app=bar"}, {"ext=web"}}
+	netpol.Ports = []string{"tcp/22", "tcp/80"}
+	netpol.Annotations = map[string][]string{"owner": {"team"}}
+
+	extnets := gaia.ExternalNetworksList{
+		{Name: "e1", AssociatedTags: []string{"ext=web"}, ServicePorts: []string{"tcp/80"}},
+	}
+
+	opts := DefaultOptions()
+	opts.Explain = true
+
+	rsl, _, _, err := ConvertToNetworkRuleSetPolicies(netpol, extnets, opts)
+	if err != nil {
+		t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+	}
+
+	if len(rsl) != 1 {
+		t.Fatalf("ConvertToNetworkRuleSetPolicies() = %d policies, want 1", len(rsl))
+	}
+
+	want := map[string][]string{
+		"owner":                        {"team"},
+		"migration:explain":            {"source=name; sourceID=id1; subject=subject[0]"},
+		"migration:explain:outgoing:0": {"source=name; sourceID=id1; object=object[0]"},
+		"migration:explain:outgoing:1": {"source=name; sourceID=id1; object=object[1]; externalNetwork=e1; ports=tcp/22 tcp/80; servicePorts=tcp/80; intersectedPorts=tcp/80"},
+		ExpandedRuleAnnotation:         {`{"object":["ext=web","$identity=externalnetwork","$name=e1","version=v2"],"source":["ext=web"],"ports":["tcp/22","tcp/80"]}`},
+	}
+	if !reflect.DeepEqual(rsl[0].Annotations, want) {
+		t.Errorf("ConvertToNetworkRuleSetPolicies() annotations = %v, want %v", rsl[0].Annotations, want)
+	}
+
+	if len(netpol.Annotations) != 1 {
+		t.Errorf("ConvertToNetworkRuleSetPolicies() modified the annotations of the policy: %v", netpol.Annotations)
+	}
+
+	t.Run("split rules", func(t *testing.T) {
+
+		opts := opts
+		opts.MultiportLimit = 2
+
+		split := netpol.DeepCopy()
+		split.Object = [][]string{{"app=bar"}}
+		split.Ports = []string{"tcp/1", "tcp/3", "tcp/5"}
+
+		rsl, _, _, err := ConvertToNetworkRuleSetPolicies(split, extnets, opts)
+		if err != nil {
+			t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+		}
+
+		if len(rsl) != 1 || len(rsl[0].OutgoingRules) != 2 {
+			t.Fatalf("ConvertToNetworkRuleSetPolicies() = %v, want 1 policy with 2 rules", rsl)
+		}
+
+		for i, suffix := range []string{"split=1/2", "split=2/2"} {
+			values := rsl[0].Annotations[explainRuleKey(explainOutgoing, i)]
+			if len(values) != 1 || !strings.HasSuffix(values[0], "; "+suffix) {
+				t.Errorf("ConvertToNetworkRuleSetPolicies() rule %d annotation = %v, want %s", i, values, suffix)
+			}
+		}
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+
+		rsl, _, _, err := ConvertToNetworkRuleSetPolicies(netpol, extnets, DefaultOptions())
+		if err != nil {
+			t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+		}
+
+		for k := range rsl[0].Annotations {
+			if isExplainAnnotation(k) {
+				t.Errorf("ConvertToNetworkRuleSetPolicies() annotation %s without Explain", k)
+			}
+		}
+	})
+}
+
+func TestMergeRuleSetPoliciesExplain(t *testing.T) {
+
+	newPolicy := func(name string, objects ...[]string) *gaia.NetworkAccessPolicy {
+		netpol := gaia.NewNetworkAccessPolicy()
+		netpol.Name = name
+		netpol.Namespace = "namespace"
+		netpol.ApplyPolicyMode = gaia.NetworkAccessPolicyApplyPolicyModeOutgoingTraffic
+		netpol.Subject = [][]string{{"app=foo"}}
+		netpol.Object = objects
+		netpol.Ports = []string{"tcp/80"}
+		return netpol
+	}
+
+	opts := DefaultOptions()
+	opts.Explain = true
+
+	input := gaia.NetworkRuleSetPoliciesList{}
+	for _, netpol := range []*gaia.NetworkAccessPolicy{
+		newPolicy("p1", []string{"app=bar"}),
+		newPolicy("p2", []string{"app=bar"}, []string{"app=qux"}),
+	} {
+		rsl, _, _, err := ConvertToNetworkRuleSetPolicies(netpol, nil, opts)
+		if err != nil {
+			t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+		}
+		input = append(input, rsl...)
+	}
+
+	got, merges := MergeRuleSetPolicies(input)
+	if len(got) != 1 || len(merges) != 1 {
+		t.Fatalf("MergeRuleSetPolicies() = %v, %v, want 1 merged policy", got, merges)
+	}
+
+	want := map[string][]string{
+		"migration:explain": {
+			"source=p1; subject=subject[0]",
+			"source=p2; subject=subject[0]",
+		},
+		"migration:explain:outgoing:0": {
+			"source=p1; object=object[0]",
+			"source=p2; object=object[0]",
+		},
+		"migration:explain:outgoing:1": {
+			"source=p2; object=object[1]",
+		},
+	}
+	if !reflect.DeepEqual(got[0].Annotations, want) {
+		t.Errorf("MergeRuleSetPolicies() annotations = %v, want %v", got[0].Annotations, want)
+	}
+
+	// The input policies keep their own provenance
+	if values := input[0].Annotations[ExplainAnnotation]; len(values) != 1 {
+		t.Errorf("MergeRuleSetPolicies() modified the input annotations: %v", input[0].Annotations)
+	}
+}
@@ -0,0 +1,166 @@
+package rulesetpolicies
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go.aporeto.io/gaia"
+)
+
+// Merge describes the rule set policies merged into one.
+type Merge struct {
+	Name      string
+	Namespace string
+	Subject   [][]string
+
+	// Sources are the unique names of the merged policies.
+	Sources []string
+
+	// Count is the number of merged policies.
+	Count int
+}
+
+func (m *Merge) String() string {
+	return fmt.Sprintf("%s (namespace: '%s'): %d policies merged from %s", m.Name, m.Namespace, m.Count, strings.Join(m.Sources, ", "))
+}
+
+// MergeRuleSetPolicies groups the rule set policies that have the same subject
+// and compatible metadata and merges their rules into a single policy. Policies
+// are compatible when they are in the same namespace and share the same
+// associated tags, metadata, annotations and disabled, fallback, propagate and
+// protected flags. Identical rules are only kept once.
+//
+// The merged policy is placed where the first policy of its group was, takes
+// the unique names and descriptions of the group joined together, and each
+// merge of two policies or more is reported. The provenance annotations added by
+// the Explain option are not compared: they are joined and follow the rules to
+// their index in the merged policy. The time annotations are not compared either:
+// the merged policy takes the earliest creation time and the latest update time.
+// Neither are the expanded rules recorded by ExpandedRuleAnnotation, which are joined.
+func MergeRuleSetPolicies(netpols gaia.NetworkRuleSetPoliciesList) (gaia.NetworkRuleSetPoliciesList, []*Merge) {
+
+	out := gaia.NetworkRuleSetPoliciesList{}
+	groups := map[string]int{}
+	sources := [][]*gaia.NetworkRuleSetPolicy{}
+
+	for _, policy := range netpols {
+
+		key := mergeKey(policy)
+
+		i, ok := groups[key]
+		if !ok {
+			groups[key] = len(out)
+			out = append(out, policy)
+			sources = append(sources, []*gaia.NetworkRuleSetPolicy{policy})
+			continue
+		}
+
+		// Keep the input untouched
+		if len(sources[i]) == 1 {
+			out[i] = out[i].DeepCopy()
+		}
+
+		merged := out[i]
+		merged.IncomingRules = appendMissingRules(merged.IncomingRules, policy.IncomingRules)
+		merged.OutgoingRules = appendMissingRules(merged.OutgoingRules, policy.OutgoingRules)
+		sources[i] = append(sources[i], policy)
+	}
+
+	merges := []*Merge{}
+
+	for i, group := range sources {
+
+		if len(group) < 2 {
+			continue
+		}
+
+		names := []string{}
+		descriptions := []string{}
+		for _, policy := range group {
+			names = appendMissingString(names, policy.Name)
+			if policy.Description != "" {
+				descriptions = appendMissingString(descriptions, policy.Description)
+			}
+		}
+
+		out[i].Name = strings.Join(names, " + ")
+		out[i].Description = strings.Join(descriptions, "\n")
+		mergeExplanations(out[i], group)
+		mergeTimes(out[i], group)
+		mergeExpandedRules(out[i], group)
+
+		merges = append(merges, &Merge{
+			Name:      out[i].Name,
+			Namespace: out[i].Namespace,
+			Subject:   out[i].Subject,
+			Sources:   names,
+			Count:     len(group),
+		})
+	}
+
+	return out, merges
+}
+
+// mergeKey returns a key identifying the policies that can be merged together.
+func mergeKey(policy *gaia.NetworkRuleSetPolicy) string {
+
+	annotations := []string{}
+	for _, k := range sortedStrings(annotationKeys(policy.Annotations)) {
+		if isExplainAnnotation(k) || isTimeAnnotation(k) || k == ExpandedRuleAnnotation {
+			continue
+		}
+		annotations = append(annotations, k+"="+strings.Join(policy.Annotations[k], "\x00"))
+	}
+
+	return strings.Join([]string{
+		policy.Namespace,
+		clausesKey(canonicalClauses(policy.Subject)),
+		strings.Join(sortedStrings(policy.AssociatedTags), "\x00"),
+		strings.Join(sortedStrings(policy.Metadata), "\x00"),
+		strings.Join(annotations, "\x00"),
+		fmt.Sprintf("%t %t %t %t", policy.Disabled, policy.Fallback, policy.Propagate, policy.Protected),
+	}, "\x02")
+}
+
+func annotationKeys(annotations map[string][]string) []string {
+
+	keys := make([]string, 0, len(annotations))
+	for k := range annotations {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
+
+// appendMissingRules appends the rules that are not already in the list.
+func appendMissingRules(rules []*gaia.NetworkRule, others []*gaia.NetworkRule) []*gaia.NetworkRule {
+
+	for _, o := range others {
+
+		found := false
+		for _, r := range rules {
+			if reflect.DeepEqual(r, o) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			rules = append(rules, o.DeepCopy())
+		}
+	}
+
+	return rules
+}
+
+func appendMissingString(list []string, s string) []string {
+
+	for _, l := range list {
+		if l == s {
+			return list
+		}
+	}
+
+	return append(list, s)
+}
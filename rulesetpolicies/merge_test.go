@@ -0,0 +1,96 @@
+package rulesetpolicies
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.aporeto.io/gaia"
+)
+
+func TestMergeRuleSetPolicies(t *testing.T) {
+
+	newPolicy := func(name string, subject []string, object []string, ports ...string) *gaia.NetworkRuleSetPolicy {
+		policy := gaia.NewNetworkRuleSetPolicy()
+		policy.Name = name
+		policy.Namespace = "/ns"
+		policy.Subject = [][]string{subject}
+		policy.OutgoingRules = []*gaia.NetworkRule{
+			{Action: gaia.NetworkRuleActionAllow, Object: [][]string{object}, ProtocolPorts: ports},
+		}
+		return policy
+	}
+
+	p1 := newPolicy("p1", []string{"app=foo", "env=prod"}, []string{"app=bar"}, "tcp/80")
+	p2 := newPolicy("p2", []string{"app=baz"}, []string{"app=bar"}, "tcp/80")
+	p3 := newPolicy("p3", []string{"env=prod", "app=foo"}, []string{"app=qux"}, "tcp/443")
+	p4 := newPolicy("p1", []string{"app=foo", "env=prod"}, []string{"app=bar"}, "tcp/80")
+	p5 := newPolicy("p5", []string{"app=foo", "env=prod"}, []string{"app=bar"}, "tcp/80")
+	p5.Fallback = true
+
+	input := gaia.NetworkRuleSetPoliciesList{p1, p2, p3, p4, p5}
+	got, merges := MergeRuleSetPolicies(input)
+
+	if len(got) != 3 {
+		t.Fatalf("MergeRuleSetPolicies() = %d policies, want 3", len(got))
+	}
+
+	merged := got[0]
+	if merged.Name != "p1 + p3" {
+		t.Errorf("MergeRuleSetPolicies() name = %s, want 'p1 + p3'", merged.Name)
+	}
+	wantRules := []*gaia.NetworkRule{
+		{Action: gaia.NetworkRuleActionAllow, Object: [][]string{{"app=bar"}}, ProtocolPorts: []string{"tcp/80"}},
+		{Action: gaia.NetworkRuleActionAllow, Object: [][]string{{"app=qux"}}, ProtocolPorts: []string{"tcp/443"}},
+	}
+	if !reflect.DeepEqual(merged.OutgoingRules, wantRules) {
+		t.Errorf("MergeRuleSetPolicies() rules = %v, want %v", merged.OutgoingRules, wantRules)
+	}
+
+	if got[1] != p2 || got[2] != p5 {
+		t.Errorf("MergeRuleSetPolicies() = %v, want p2 and p5 unchanged", got)
+	}
+
+	if len(p1.OutgoingRules) != 1 || p1.Name != "p1" {
+		t.Errorf("MergeRuleSetPolicies() modified its input: %v", p1)
+	}
+
+	if len(merges) != 1 || merges[0].Count != 3 || !reflect.DeepEqual(merges[0].Sources, []string{"p1", "p3"}) {
+		t.Errorf("MergeRuleSetPolicies() merges = %v, want p1 and p3", merges)
+	}
+}
+
+func TestMergeRuleSetPoliciesTimes(t *testing.T) {
+
+	newPolicy := func(name string, createTime time.Time, updateTime time.Time) *gaia.NetworkRuleSetPolicy {
+		policy := gaia.NewNetworkRuleSetPolicy()
+		policy.Name = name
+		policy.Namespace = "/ns"
+		policy.Subject = [][]string{{"app=foo"}}
+		setTimes(policy, createTime, updateTime)
+		return policy
+	}
+
+	day := func(d int) time.Time { return time.Date(2020, time.March, d, 0, 0, 0, 0, time.UTC) }
+
+	got, _ := MergeRuleSetPolicies(gaia.NetworkRuleSetPoliciesList{
+		newPolicy("p1", day(2), day(3)),
+		newPolicy("p2", day(1), day(2)),
+		newPolicy("p3", day(4), day(5)),
+	})
+
+	if len(got) != 1 {
+		t.Fatalf("MergeRuleSetPolicies() = %d policies, want 1", len(got))
+	}
+
+	want := map[string][]string{
+		CreateTimeAnnotation: {"2020-03-01T00:00:00Z"},
+		UpdateTimeAnnotation: {"2020-03-05T00:00:00Z"},
+	}
+	if !reflect.DeepEqual(got[0].Annotations, want) {
+		t.Errorf("MergeRuleSetPolicies() annotations = %v, want %v", got[0].Annotations, want)
+	}
+	if !got[0].CreateTime.Equal(day(1)) || !got[0].UpdateTime.Equal(day(5)) {
+		t.Errorf("MergeRuleSetPolicies() times = %s %s, want %s %s", got[0].CreateTime, got[0].UpdateTime, day(1), day(5))
+	}
+}
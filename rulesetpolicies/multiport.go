@@ -0,0 +1,93 @@
+package rulesetpolicies
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/satyamsi/migrate/intersection"
+	"go.aporeto.io/gaia"
+)
+
+// splitPolicyRules splits the rules of the policies that hold more TCP or UDP ports than the limit.
+// The split rules get the provenance of the rule they come from.
+func splitPolicyRules(netpols gaia.NetworkRuleSetPoliciesList, limit int, prov provenance) {
+
+	for _, policy := range netpols {
+		policy.IncomingRules = splitRules(policy.IncomingRules, limit, prov)
+		policy.OutgoingRules = splitRules(policy.OutgoingRules, limit, prov)
+	}
+}
+
+// splitRules returns the rules with the ones holding more TCP or UDP ports than the limit split into several rules.
+func splitRules(rules []*gaia.NetworkRule, limit int, prov provenance) []*gaia.NetworkRule {
+
+	out := make([]*gaia.NetworkRule, 0, len(rules))
+	for _, rule := range rules {
+		split := splitRule(rule, limit)
+		if len(split) > 1 && prov != nil {
+			for i, r := range split {
+				prov.derive(rule, r, fmt.Sprintf("split=%d/%d", i+1, len(split)))
+			}
+		}
+		out = append(out, split...)
+	}
+
+	return out
+}
+
+// splitRule splits the TCP and UDP ports of the rule into groups that respect
+// the limit and returns one rule per group. The protocols without ports are
+// kept in the first rule.
+func splitRule(rule *gaia.NetworkRule, limit int) []*gaia.NetworkRule {
+
+	var tcpPorts, udpPorts, others []string
+	for _, entry := range rule.ProtocolPorts {
+		lower := strings.ToLower(entry)
+		switch {
+		case strings.HasPrefix(lower, "tcp/"):
+			tcpPorts = append(tcpPorts, entry[len("tcp/"):])
+		case strings.HasPrefix(lower, "udp/"):
+			udpPorts = append(udpPorts, entry[len("udp/"):])
+		default:
+			others = append(others, entry)
+		}
+	}
+
+	tcpGroups := intersection.SplitMultiport(tcpPorts, limit)
+	udpGroups := intersection.SplitMultiport(udpPorts, limit)
+
+	n := len(tcpGroups)
+	if len(udpGroups) > n {
+		n = len(udpGroups)
+	}
+
+	if n <= 1 {
+		return []*gaia.NetworkRule{rule}
+	}
+
+	rules := make([]*gaia.NetworkRule, n)
+	for i := range rules {
+
+		protocolPorts := []string{}
+		if i == 0 {
+			protocolPorts = append(protocolPorts, others...)
+		}
+		if i < len(tcpGroups) {
+			for _, port := range tcpGroups[i] {
+				protocolPorts = append(protocolPorts, "tcp/"+port)
+			}
+		}
+		if i < len(udpGroups) {
+			for _, port := range udpGroups[i] {
+				protocolPorts = append(protocolPorts, "udp/"+port)
+			}
+		}
+		sort.Strings(protocolPorts)
+
+		rules[i] = rule.DeepCopy()
+		rules[i].ProtocolPorts = protocolPorts
+	}
+
+	return rules
+}
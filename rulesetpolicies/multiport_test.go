@@ -0,0 +1,110 @@
+package rulesetpolicies
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"go.aporeto.io/gaia"
+)
+
+func Test_splitRule(t *testing.T) {
+
+	ports := func(protocol string, from, n int) []string {
+		out := make([]string, n)
+		for i := range out {
+			out[i] = fmt.Sprintf("%s/%d", protocol, from+i)
+		}
+		return out
+	}
+
+	tests := []struct {
+		name          string
+		protocolPorts []string
+		limit         int
+		want          [][]string
+	}{
+		{
+			name:          "under the limit",
+			protocolPorts: []string{"icmp", "tcp/80", "udp/53"},
+			limit:         15,
+			want:          [][]string{{"icmp", "tcp/80", "udp/53"}},
+		},
+		{
+			name:          "tcp over the limit",
+			protocolPorts: append([]string{"icmp"}, ports("tcp", 1000, 4)...),
+			limit:         3,
+			want: [][]string{
+				{"icmp", "tcp/1000", "tcp/1001", "tcp/1002"},
+				{"tcp/1003"},
+			},
+		},
+		{
+			name:          "tcp and udp over the limit",
+			protocolPorts: []string{"tcp/1:10", "tcp/20:30", "udp/1", "udp/2", "udp/3", "udp/4", "udp/5"},
+			limit:         2,
+			want: [][]string{
+				{"tcp/1:10", "udp/1", "udp/2"},
+				{"tcp/20:30", "udp/3", "udp/4"},
+				{"udp/5"},
+			},
+		},
+		{
+			name:          "disabled",
+			protocolPorts: ports("tcp", 1000, 20),
+			limit:         0,
+			want:          [][]string{ports("tcp", 1000, 20)},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule := gaia.NewNetworkRule()
+			rule.Object = [][]string{{"app=foo"}}
+			rule.ProtocolPorts = tt.protocolPorts
+
+			got := [][]string{}
+			for _, r := range splitRule(rule, tt.limit) {
+				if !reflect.DeepEqual(r.Object, rule.Object) {
+					t.Errorf("splitRule() object = %v, want %v", r.Object, rule.Object)
+				}
+				got = append(got, r.ProtocolPorts)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitRule() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConvertToNetworkRuleSetPoliciesMultiport(t *testing.T) {
+
+	netpol := gaia.NewNetworkAccessPolicy()
+	netpol.Name = "name"
+	netpol.ApplyPolicyMode = gaia.NetworkAccessPolicyApplyPolicyModeOutgoingTraffic
+	netpol.Action = gaia.NetworkAccessPolicyActionAllow
+	netpol.Subject = [][]string{{"app=foo"}}
+	netpol.Object = [][]string{{"app=bar"}}
+
+	extnet := gaia.NewExternalNetwork()
+	extnet.Name = "x"
+	extnet.AssociatedTags = []string{"app=bar"}
+	extnet.ServicePorts = []string{}
+	for i := 0; i < 20; i++ {
+		extnet.ServicePorts = append(extnet.ServicePorts, fmt.Sprintf("tcp/%d", 1000+2*i))
+	}
+
+	rsl, _, _, err := ConvertToNetworkRuleSetPolicies(netpol, gaia.ExternalNetworksList{extnet}, DefaultOptions())
+	if err != nil {
+		t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+	}
+
+	if len(rsl) != 1 {
+		t.Fatalf("ConvertToNetworkRuleSetPolicies() = %d policies, want 1", len(rsl))
+	}
+
+	rules := rsl[0].OutgoingRules
+	if len(rules) != 2 || len(rules[0].ProtocolPorts) != 15 || len(rules[1].ProtocolPorts) != 5 {
+		t.Errorf("ConvertToNetworkRuleSetPolicies() rules = %v, want 15 and 5 ports", rules)
+	}
+}
@@ -0,0 +1,97 @@
+package rulesetpolicies
+
+import (
+	"fmt"
+	"strings"
+
+	"go.aporeto.io/gaia"
+)
+
+// namespacePrefix is the prefix of the tag selecting objects by namespace.
+const namespacePrefix = "$namespace="
+
+// ExternalNetworkVisible returns true if a policy of the given namespace can select the
+// external network. Like on the platform, an external network is visible in its own
+// namespace and, when it is propagated, in the children of its namespace, never in its
+// siblings. An empty namespace on either side, as in an export that leaves the namespaces
+// out, is considered visible.
+func ExternalNetworkVisible(extnet *gaia.ExternalNetwork, namespace string) bool {
+
+	if extnet.Namespace == "" || namespace == "" || extnet.Namespace == namespace {
+		return true
+	}
+
+	return extnet.Propagate && isChildNamespace(namespace, extnet.Namespace)
+}
+
+// visibleExternalNetworks returns the external networks visible in the given namespace.
+func visibleExternalNetworks(extnets gaia.ExternalNetworksList, namespace string) gaia.ExternalNetworksList {
+
+	out := gaia.ExternalNetworksList{}
+	for _, extnet := range extnets {
+		if ExternalNetworkVisible(extnet, namespace) {
+			out = append(out, extnet)
+		}
+	}
+
+	return out
+}
+
+// selectableExternalNetworks returns the external networks a network access policy can select:
+// the ones visible in its namespace and, when the policy is propagated, the ones of the children
+// of its namespace, since the policy applies there too.
+func selectableExternalNetworks(extnets gaia.ExternalNetworksList, netpol *gaia.NetworkAccessPolicy) gaia.ExternalNetworksList {
+
+	out := gaia.ExternalNetworksList{}
+	for _, extnet := range extnets {
+		if ExternalNetworkVisible(extnet, netpol.Namespace) || (netpol.Propagate && isChildNamespace(extnet.Namespace, netpol.Namespace)) {
+			out = append(out, extnet)
+		}
+	}
+
+	return out
+}
+
+// isChildNamespace returns true if namespace is a descendant of parent.
+func isChildNamespace(namespace, parent string) bool {
+
+	if parent == "/" {
+		return namespace != "/"
+	}
+
+	return strings.HasPrefix(namespace, parent+"/")
+}
+
+// externalNetworkID returns the key identifying an external network within an export: its
+// name, preceded by its namespace when it is known.
+func externalNetworkID(extnet *gaia.ExternalNetwork) string {
+
+	if extnet.Namespace == "" {
+		return extnet.Name
+	}
+
+	return extnet.Namespace + "/" + extnet.Name
+}
+
+// quoteExternalNetwork returns the quoted name of an external network for messages,
+// followed by its namespace when it is known.
+func quoteExternalNetwork(extnet *gaia.ExternalNetwork) string {
+
+	if extnet.Namespace == "" {
+		return fmt.Sprintf("'%s'", extnet.Name)
+	}
+
+	return fmt.Sprintf("'%s' (namespace: '%s')", extnet.Name, extnet.Namespace)
+}
+
+// containsTag returns true if tags holds tag.
+func containsTag(tags []string, tag string) bool {
+
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,75 @@
+package rulesetpolicies
+
+import (
+	"reflect"
+	"testing"
+
+	"go.aporeto.io/gaia"
+)
+
+func TestConvertToNetworkRuleSetPoliciesPropagated(t *testing.T) {
+
+	extnets := gaia.ExternalNetworksList{
+		{Name: "internet", Namespace: "/corp", Propagate: true, AssociatedTags: []string{"ext=web"}, ServicePorts: []string{"tcp/443"}},
+		{Name: "proxy", Namespace: "/corp/dmz", AssociatedTags: []string{"ext=web"}, ServicePorts: []string{"tcp/8080"}},
+		{Name: "lab", Namespace: "/lab", AssociatedTags: []string{"ext=web"}},
+	}
+
+	netpol := gaia.NewNetworkAccessPolicy()
+	netpol.Name = "name"
+	netpol.Namespace = "/corp"
+	netpol.ApplyPolicyMode = gaia.NetworkAccessPolicyApplyPolicyModeOutgoingTraffic
+	netpol.Subject = [][]string{{"app=foo"}}
+	netpol.Object = [][]string{{"ext=web"}}
+	netpol.Ports = []string{"tcp/443", "tcp/8080"}
+
+	tests := []struct {
+		name        string
+		propagate   bool
+		wantExtnets []string
+		wantPorts   [][]string
+	}{
+		{
+			name:        "not propagated",
+			wantExtnets: []string{"/corp/internet"},
+			wantPorts:   [][]string{{"tcp/443"}},
+		},
+		{
+			// The policy also applies in /corp/dmz, where it selects proxy
+			name:        "propagated",
+			propagate:   true,
+			wantExtnets: []string{"/corp/internet", "/corp/dmz/proxy"},
+			wantPorts:   [][]string{{"tcp/443"}, {"tcp/8080"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			np := netpol.DeepCopy()
+			np.Propagate = tt.propagate
+
+			rsl, netl, _, err := ConvertToNetworkRuleSetPolicies(np, extnets, DefaultOptions())
+			if err != nil {
+				t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+			}
+
+			got := []string{}
+			for _, extnet := range netl {
+				got = append(got, externalNetworkID(extnet))
+			}
+			if !reflect.DeepEqual(got, tt.wantExtnets) {
+				t.Errorf("ConvertToNetworkRuleSetPolicies() external networks = %v, want %v", got, tt.wantExtnets)
+			}
+
+			if len(rsl) != 1 || len(rsl[0].OutgoingRules) != len(tt.wantPorts) {
+				t.Fatalf("ConvertToNetworkRuleSetPolicies() = %v, want one policy with %d rules", rsl, len(tt.wantPorts))
+			}
+			for i, rule := range rsl[0].OutgoingRules {
+				if !reflect.DeepEqual(rule.ProtocolPorts, tt.wantPorts[i]) {
+					t.Errorf("ConvertToNetworkRuleSetPolicies() rule %d ports = %v, want %v", i, rule.ProtocolPorts, tt.wantPorts[i])
+				}
+			}
+		})
+	}
+}
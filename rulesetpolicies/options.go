@@ -0,0 +1,119 @@
+package rulesetpolicies
+
+import (
+	"github.com/satyamsi/migrate/intersection"
+	"go.uber.org/zap"
+)
+
+// ContinueStrategy defines how network access policies with the Continue action are converted.
+type ContinueStrategy string
+
+// Supported strategies for the Continue action.
+const (
+	// ContinueStrategyFallThrough generates no rule set policy. A Continue
+	// policy takes no decision: the traffic it matches is decided by the other
+	// policies, which is what happens in the v2 model when no rule matches.
+	ContinueStrategyFallThrough ContinueStrategy = "fallthrough"
+
+	// ContinueStrategyReview generates the rule set policies the policy would
+	// produce with the Allow action, disabled and tagged with ReviewTag, so they
+	// can be reviewed and enabled or deleted by hand. DisabledAnnotation
+	// records whether the policy was disabled.
+	ContinueStrategyReview ContinueStrategy = "review"
+)
+
+// Default tags added by the conversion.
+const (
+	// DefaultMarkerTag is the default tag marking the objects created by the conversion.
+	DefaultMarkerTag = "version=v2"
+
+	// DefaultIneffectiveTag is the default tag marking the rules matching no traffic.
+	DefaultIneffectiveTag = "policy=ineffective"
+)
+
+// ReviewTag is the tag associated to the rule set policies that need a manual review.
+const ReviewTag = "migration=review"
+
+// Annotations recording what the conversion changed on the rule set policies it disables,
+// so the downgrade can restore it.
+const (
+	// DisabledAnnotation holds, on the rule set policies disabled by the conversion, whether
+	// the network access policy they come from was disabled, as 'true' or 'false'.
+	DisabledAnnotation = "migration:disabled"
+
+	// ReviewActionAnnotation holds, on the rule set policies tagged with ReviewTag, the action
+	// of the network access policy they come from. Rule set policies tagged for review without
+	// it come from Continue policies.
+	ReviewActionAnnotation = "migration:review:action"
+)
+
+// Options holds the options of a conversion.
+type Options struct {
+	// MultiportLimit is the maximum number of TCP or UDP ports of a generated
+	// network rule, counting a range as two ports. Rules with more ports are
+	// split into several rules. A value lower than two disables the split.
+	MultiportLimit int
+
+	// ContinueStrategy is the strategy used for policies with the Continue action.
+	// An empty strategy is ContinueStrategyFallThrough.
+	ContinueStrategy ContinueStrategy
+
+	// MarkerTag is added to the tags of the v2 copies of the external networks
+	// and to the objects of the rules selecting them, so the rules only match
+	// the copies. No tag is added if it is empty.
+	MarkerTag string
+
+	// IneffectiveTag is added as an additional object clause to the rules that
+	// match no traffic, because the ports of the policy and of the external
+	// network do not intersect. No clause is added if it is empty.
+	IneffectiveTag string
+
+	// DropIneffective omits the rules that match no traffic instead of marking
+	// them with IneffectiveTag, along with the rule set policies left without
+	// rules. Each dropped rule is reported with a WarningIneffectiveRuleDropped
+	// warning.
+	DropIneffective bool
+
+	// Strict fails the conversion of a policy with a port, or selecting an external network
+	// with a service port, that cannot be parsed, instead of reporting it with a
+	// WarningInvalidPort warning. Invalid ports are otherwise left out of the rules, and a
+	// policy left without a valid port is generated disabled.
+	Strict bool
+
+	// Deterministic makes the output independent of the order of the input:
+	// the tags, clauses, protocols and ports of the generated objects are
+	// sorted and their timestamps are cleared.
+	Deterministic bool
+
+	// Logger logs the decisions of the conversion at debug level: the external networks
+	// matched by each rule, the intersections of their ports and the dropped rules.
+	// Nothing is logged if it is nil.
+	Logger *zap.Logger
+
+	// Explain annotates the generated rule set policies with the provenance of the policies
+	// and of each of their rules, see ExplainAnnotation and ExplainRuleAnnotationPrefix.
+	Explain bool
+
+	// provenance records the provenance of the rules during a conversion with Explain.
+	provenance provenance
+}
+
+// logger returns the logger of the options, or a no-op logger if it is nil.
+func (o Options) logger() *zap.Logger {
+
+	if o.Logger == nil {
+		return zap.NewNop()
+	}
+
+	return o.Logger
+}
+
+// DefaultOptions returns the default options of a conversion.
+func DefaultOptions() Options {
+	return Options{
+		MultiportLimit:   intersection.MultiportLimit,
+		ContinueStrategy: ContinueStrategyFallThrough,
+		MarkerTag:        DefaultMarkerTag,
+		IneffectiveTag:   DefaultIneffectiveTag,
+	}
+}
@@ -0,0 +1,83 @@
+package rulesetpolicies
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Report summarizes the conversion of a list of network access policies.
+type Report struct {
+	Converted int
+	Failures  []*PolicyError
+	Warnings  []*Warning
+	Dropped   []*Warning
+	Merges    []*Merge
+}
+
+// Add records the outcome of the conversion of one network access policy.
+func (r *Report) Add(err error) {
+
+	if err == nil {
+		r.Converted++
+		return
+	}
+
+	var perr *PolicyError
+	if !errors.As(err, &perr) {
+		perr = &PolicyError{Err: err}
+	}
+	r.Failures = append(r.Failures, perr)
+}
+
+// AddWarnings records the warnings of the conversion of one network access policy.
+// The rules dropped as ineffective are recorded apart from the other warnings.
+func (r *Report) AddWarnings(warnings ...*Warning) {
+
+	for _, w := range warnings {
+		if w.Code == WarningIneffectiveRuleDropped {
+			r.Dropped = append(r.Dropped, w)
+			continue
+		}
+		r.Warnings = append(r.Warnings, w)
+	}
+}
+
+// AddMerges records the rule set policies merged after the conversion.
+func (r *Report) AddMerges(merges ...*Merge) {
+	r.Merges = append(r.Merges, merges...)
+}
+
+// Write prints a human readable summary of the report to w.
+func (r *Report) Write(w io.Writer) {
+
+	fmt.Fprintf(w, "Converted %d of %d network access policies\n", r.Converted, r.Converted+len(r.Failures))
+
+	if len(r.Merges) != 0 {
+		fmt.Fprintf(w, "%d groups of rule set policies merged:\n", len(r.Merges))
+		for _, m := range r.Merges {
+			fmt.Fprintf(w, "  - %s\n", m)
+		}
+	}
+
+	if len(r.Dropped) != 0 {
+		fmt.Fprintf(w, "%d rules dropped as ineffective:\n", len(r.Dropped))
+		for _, d := range r.Dropped {
+			fmt.Fprintf(w, "  - %s (namespace: '%s'): %s\n", d.Name, d.Namespace, d.Message)
+		}
+	}
+
+	if len(r.Warnings) != 0 {
+		fmt.Fprintf(w, "%d warnings:\n", len(r.Warnings))
+		for _, warning := range r.Warnings {
+			fmt.Fprintf(w, "  - %s\n", warning)
+		}
+	}
+
+	if len(r.Failures) != 0 {
+		fmt.Fprintf(w, "%d network access policies failed to convert:\n", len(r.Failures))
+		for _, f := range r.Failures {
+			fmt.Fprintf(w, "  - %s (namespace: '%s'): %s\n", f.Name, f.Namespace, f.Err)
+		}
+	}
+}
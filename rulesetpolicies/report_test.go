@@ -0,0 +1,39 @@
+package rulesetpolicies
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestReport(t *testing.T) {
+
+	r := &Report{}
+	r.Add(nil)
+	r.Add(nil)
+	r.Add(&PolicyError{Name: "p1", Namespace: "/ns", Err: ErrUnknownTag})
+	r.Add(fmt.Errorf("boom"))
+	r.AddWarnings(&Warning{Name: "p2", Namespace: "/ns", Code: WarningContinueAction, Message: "no rule set policy generated"})
+	r.AddWarnings(&Warning{Name: "p3", Namespace: "/ns", Code: WarningIneffectiveRuleDropped, Message: "rule to external network 'e1' dropped"})
+
+	if len(r.Warnings) != 1 || len(r.Dropped) != 1 {
+		t.Errorf("Report warnings = %v, dropped = %v, want one of each", r.Warnings, r.Dropped)
+	}
+
+	if r.Converted != 2 {
+		t.Errorf("Report.Converted = %d, want 2", r.Converted)
+	}
+	if len(r.Failures) != 2 {
+		t.Fatalf("len(Report.Failures) = %d, want 2", len(r.Failures))
+	}
+
+	buf := &bytes.Buffer{}
+	r.Write(buf)
+
+	for _, want := range []string{"Converted 2 of 4", "p1 (namespace: '/ns'): unknown tag", "boom", "1 warnings", "p2 (namespace: '/ns'): ContinueAction: no rule set policy generated", "1 rules dropped as ineffective", "p3 (namespace: '/ns'): rule to external network 'e1' dropped"} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("Report.Write() = %s, missing %s", buf.String(), want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package rulesetpolicies
+
+import (
+	"strconv"
+	"strings"
+
+	"go.aporeto.io/gaia"
+)
+
+// ExternalNetworkMetadataTags returns the metadata tags, starting with '$', an external
+// network can be selected with. They are built from its attributes, as the platform does,
+// and completed with its normalized tags. The ID and namespace tags are only returned
+// when they are known, which is not the case in an export.
+func ExternalNetworkMetadataTags(extnet *gaia.ExternalNetwork) []string {
+
+	tags := []string{externalNetworkKey, "$name=" + extnet.Name}
+
+	if extnet.ID != "" {
+		tags = append(tags, "$id="+extnet.ID)
+	}
+
+	if extnet.Namespace != "" {
+		tags = append(tags, namespacePrefix+extnet.Namespace)
+	}
+
+	if extnet.Description != "" {
+		tags = append(tags, "$description="+extnet.Description)
+	}
+
+	tags = append(tags,
+		"$propagate="+strconv.FormatBool(extnet.Propagate),
+		"$protected="+strconv.FormatBool(extnet.Protected),
+	)
+
+	for _, tag := range extnet.NormalizedTags {
+		if strings.HasPrefix(tag, "$") && !containsTag(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+// matchMetadataTag returns whether the metadata tag matches the given metadata tags of an
+// external network. It returns false with known set to false if the metadata tags hold
+// no value for the key of the tag, in which case the tag cannot be evaluated.
+func matchMetadataTag(metadata []string, tag string) (matched bool, known bool) {
+
+	key := tag
+	if i := strings.Index(tag, "="); i >= 0 {
+		key = tag[:i+1]
+	}
+
+	for _, t := range metadata {
+		if t == tag {
+			return true, true
+		}
+		if strings.HasPrefix(t, key) {
+			known = true
+		}
+	}
+
+	return false, known
+}
+
+// selectsOtherIdentity returns true if the clause holds an '$identity=' tag of another
+// identity than external networks, like processing units.
+func selectsOtherIdentity(clause []string) bool {
+
+	for _, tag := range clause {
+		if strings.HasPrefix(strings.ToLower(tag), identityPrefix) && !strings.EqualFold(tag, externalNetworkKey) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// unknownExternalNetworkAttribute returns true if the metadata tag is built from an attribute of
+// the external network whose value is not known, like the ID of an external network in an export.
+func unknownExternalNetworkAttribute(extnet *gaia.ExternalNetwork, tag string) bool {
+
+	switch {
+	case strings.HasPrefix(tag, "$id="):
+		return extnet.ID == ""
+	case strings.HasPrefix(tag, namespacePrefix):
+		return extnet.Namespace == ""
+	}
+
+	return false
+}
+
+// containsTagFold returns true if the tags contain the tag, ignoring case.
+func containsTagFold(tags []string, tag string) bool {
+
+	for _, t := range tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// MatchExternalNetworks returns the external networks selected by a clause of a policy of
+// the given namespace, like the conversion does. It returns an error wrapping ErrUnknownTag
+// if the clause selects external networks by an attribute whose value is not known.
+func MatchExternalNetworks(clause []string, extnets gaia.ExternalNetworksList, namespace string) (gaia.ExternalNetworksList, error) {
+
+	out := gaia.ExternalNetworksList{}
+	for _, extnet := range visibleExternalNetworks(extnets, namespace) {
+		matched, err := externalNetworksMatchTags(extnet, clause)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			out = append(out, extnet)
+		}
+	}
+
+	return out, nil
+}
@@ -0,0 +1,92 @@
+package rulesetpolicies
+
+import (
+	"time"
+
+	"go.aporeto.io/gaia"
+)
+
+// Annotations recording the times of the network access policies. The export leaves out the
+// creation and update times of the objects, like every attribute set by the platform, so the
+// times of the converted policies are carried by annotations.
+const (
+	// CreateTimeAnnotation holds the creation time of the network access policy a rule set
+	// policy comes from, in RFC 3339 format. A merged rule set policy holds the earliest
+	// creation time of the merged policies.
+	CreateTimeAnnotation = "migration:createTime"
+
+	// UpdateTimeAnnotation holds the update time of the network access policy a rule set
+	// policy comes from, in RFC 3339 format. A merged rule set policy holds the latest
+	// update time of the merged policies.
+	UpdateTimeAnnotation = "migration:updateTime"
+)
+
+func isTimeAnnotation(key string) bool {
+	return key == CreateTimeAnnotation || key == UpdateTimeAnnotation
+}
+
+// setTimes sets the times of a rule set policy and their annotations, on a copy of its
+// annotations. Zero times are not recorded.
+func setTimes(policy *gaia.NetworkRuleSetPolicy, createTime time.Time, updateTime time.Time) {
+
+	policy.CreateTime = createTime
+	policy.UpdateTime = updateTime
+
+	if !createTime.IsZero() {
+		setAnnotation(policy, CreateTimeAnnotation, createTime.UTC().Format(time.RFC3339Nano))
+	}
+
+	if !updateTime.IsZero() {
+		setAnnotation(policy, UpdateTimeAnnotation, updateTime.UTC().Format(time.RFC3339Nano))
+	}
+}
+
+// annotatedTime returns the time held by the annotation, or the given time if the
+// annotation is missing or invalid.
+func annotatedTime(annotations map[string][]string, key string, t time.Time) time.Time {
+
+	values := annotations[key]
+	if len(values) != 1 {
+		return t
+	}
+
+	annotated, err := time.Parse(time.RFC3339Nano, values[0])
+	if err != nil {
+		return t
+	}
+
+	return annotated
+}
+
+// mergeTimes sets the earliest creation time and the latest update time of the policies
+// of its group on a merged rule set policy.
+func mergeTimes(merged *gaia.NetworkRuleSetPolicy, group []*gaia.NetworkRuleSetPolicy) {
+
+	var createTime, updateTime time.Time
+	for _, policy := range group {
+
+		t := annotatedTime(policy.Annotations, CreateTimeAnnotation, policy.CreateTime)
+		if !t.IsZero() && (createTime.IsZero() || t.Before(createTime)) {
+			createTime = t
+		}
+
+		t = annotatedTime(policy.Annotations, UpdateTimeAnnotation, policy.UpdateTime)
+		if t.After(updateTime) {
+			updateTime = t
+		}
+	}
+
+	setTimes(merged, createTime, updateTime)
+}
+
+// setAnnotation sets the values of an annotation of a rule set policy, on a copy of its annotations.
+func setAnnotation(policy *gaia.NetworkRuleSetPolicy, key string, values ...string) {
+
+	annotations := make(map[string][]string, len(policy.Annotations)+1)
+	for k, v := range policy.Annotations {
+		annotations[k] = v
+	}
+	annotations[key] = values
+
+	policy.Annotations = annotations
+}
@@ -3,12 +3,14 @@ package rulesetpolicies
 import (
 	"fmt"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/satyamsi/migrate/intersection"
 	"go.aporeto.io/gaia"
 	"go.aporeto.io/gaia/protocols"
+	"go.uber.org/zap"
 )
 
 const (
@@ -18,34 +20,59 @@ const (
 	// externalNetworkKey is the key representation for external network identity key
 	externalNetworkKey = "$identity=externalnetwork"
 
-	// ineffectiveKey represents the key that labels network rules that are not meaningful
-	ineffectiveKey = "policy=ineffective"
+	// identityPrefix is the prefix of the tag selecting objects by identity
+	identityPrefix = "$identity="
 )
 
 // ConvertToNetworkRuleSetPolicies converts a network access policy to one or more network rule set policies.
+// The warnings report the parts of the policy whose behavior is not fully preserved by the conversion.
+// The external networks are expected to have unique names in each namespace: check them once with
+// DuplicateExternalNetworks and CheckDuplicateExternalNetworks before converting the policies.
 func ConvertToNetworkRuleSetPolicies(
 	netpol *gaia.NetworkAccessPolicy,
 	extnet gaia.ExternalNetworksList,
+	opts Options,
 ) (
 	outNetPolList gaia.NetworkRuleSetPoliciesList,
 	outExtNetList gaia.ExternalNetworksList,
+	warnings []*Warning,
+	err error,
 ) {
 
-	// Detect if external networks have duplicate names
-	dupExtnetChecker := map[string]interface{}{}
-	for _, e := range extnet {
-		if _, ok := dupExtnetChecker[e.Name]; ok {
-			panic("duplicate name: " + e.Name)
-		}
-		dupExtnetChecker[e.Name] = nil
+	// Every decision is logged along with the policy it is taken for
+	opts.Logger = opts.logger().With(zap.String("policy", netpol.Name), zap.String("namespace", netpol.Namespace))
+	opts.Logger.Debug("converting network access policy",
+		zap.String("action", string(netpol.Action)),
+		zap.String("applyPolicyMode", string(netpol.ApplyPolicyMode)),
+	)
+
+	opts.provenance = nil
+	if opts.Explain {
+		opts.provenance = provenance{}
 	}
 
 	outNetPolList = gaia.NetworkRuleSetPoliciesList{}
 	outExtNetList = gaia.ExternalNetworksList{}
+	warnings = []*Warning{}
+
+	// Network rules have no `Continue` action, see ContinueStrategy
+	var review bool
+	action := gaia.NetworkRuleActionAllow
 
-	// If action is `Continue` we will ignore these as there is no translation
 	if netpol.Action == gaia.NetworkAccessPolicyActionContinue {
-		return outNetPolList, outExtNetList
+		switch opts.ContinueStrategy {
+		case ContinueStrategyFallThrough, "":
+			warnings = append(warnings, newWarning(netpol, WarningContinueAction, "no rule set policy generated, the traffic it matches is decided by the other policies"))
+			opts.Logger.Debug("no rule set policy generated for the Continue action", zap.String("strategy", string(opts.ContinueStrategy)))
+			return outNetPolList, outExtNetList, warnings, nil
+		case ContinueStrategyReview:
+			warnings = append(warnings, newWarning(netpol, WarningContinueAction, "rule set policies generated disabled with the tag '%s' for manual review", ReviewTag))
+			review = true
+		default:
+			return nil, nil, nil, NewPolicyError(netpol, fmt.Errorf("%w: '%s' with strategy '%s'", ErrUnsupportedAction, netpol.Action, opts.ContinueStrategy))
+		}
+	} else if action, err = convertToNetworkRuleAction(netpol.Action); err != nil {
+		return nil, nil, nil, NewPolicyError(netpol, err)
 	}
 
 	networkRuleSetPolicy := gaia.NewNetworkRuleSetPolicy()
@@ -60,16 +87,46 @@ func ConvertToNetworkRuleSetPolicies(
 	networkRuleSetPolicy.Metadata = netpol.Metadata
 	networkRuleSetPolicy.Annotations = netpol.Annotations
 
-	now := time.Now().Round(time.Millisecond)
-	networkRuleSetPolicy.CreateTime = now
-	networkRuleSetPolicy.UpdateTime = now
+	// Rule set policies are always active, see checkActivation
+	expired, scheduled, activationWarnings := checkActivation(netpol, time.Now())
+	warnings = append(warnings, activationWarnings...)
+
+	if review || scheduled {
+		networkRuleSetPolicy.AssociatedTags = append(append([]string{}, netpol.AssociatedTags...), ReviewTag)
+		setAnnotation(networkRuleSetPolicy, ReviewActionAnnotation, string(netpol.Action))
+	}
+
+	// Invalid ports are left out of the rules, see Options.Strict
+	var invalidPorts []string
+	ports, invalid := intersection.FilterProtocolPorts(netpol.Ports)
+	for _, p := range invalid {
+		warnings = append(warnings, newWarning(netpol, WarningInvalidPort, "invalid port %s left out of the rules", p))
+		invalidPorts = append(invalidPorts, p.String())
+	}
+
+	// Rules without ports match any port, so a policy left without a valid port is disabled
+	unmatchable := len(netpol.Ports) != 0 && len(ports) == 0
+	if unmatchable {
+		warnings = append(warnings, newWarning(netpol, WarningInvalidPort, "no valid port left: rule set policies generated disabled"))
+	}
+
+	if review || scheduled || expired || unmatchable {
+		networkRuleSetPolicy.Disabled = true
+		setAnnotation(networkRuleSetPolicy, DisabledAnnotation, strconv.FormatBool(netpol.Disabled))
+	}
+
+	setTimes(networkRuleSetPolicy, netpol.CreateTime, netpol.UpdateTime)
 
 	networkRule := gaia.NewNetworkRule()
-	networkRule.Action = convertToNetworkRuleAction(netpol.Action)
+	networkRule.Action = action
 	networkRule.LogsDisabled = !netpol.LogsEnabled
-	networkRule.ProtocolPorts = netpol.Ports
-	// NOTE: We have no conversion for ObservedTrafficAction
-	networkRule.ObservationEnabled = netpol.ObservationEnabled
+	networkRule.ProtocolPorts = ports
+
+	observationEnabled, warning := convertObservation(netpol)
+	networkRule.ObservationEnabled = observationEnabled
+	if warning != nil {
+		warnings = append(warnings, warning)
+	}
 
 	// Bidirectional policies require two rule set policies:
 	// 1) An incoming rule set policy from the object to the subject
@@ -78,17 +135,23 @@ func ConvertToNetworkRuleSetPolicies(
 	if netpol.ApplyPolicyMode == gaia.NetworkAccessPolicyApplyPolicyModeIncomingTraffic ||
 		netpol.ApplyPolicyMode == gaia.NetworkAccessPolicyApplyPolicyModeBidirectional {
 		// Incoming rule set policies
-		for _, subject := range netpol.Object {
+		for j, subject := range netpol.Object {
 			// Create a new rule set policy
 			policy := networkRuleSetPolicy.DeepCopy()
 			policy.Subject = [][]string{subject}
 			policy.IncomingRules = make([]*gaia.NetworkRule, len(netpol.Subject))
+			if opts.Explain {
+				explainPolicy(policy, append(explainSource(netpol), explainClause("subject", "object", j))...)
+			}
 
 			// Create a rule for each 'OR' clause
 			for i, object := range netpol.Subject {
 				rule := networkRule.DeepCopy()
 				rule.Object = [][]string{object}
 				policy.IncomingRules[i] = rule
+				if opts.Explain {
+					opts.provenance.add(rule, append(explainSource(netpol), explainClause("object", "subject", i))...)
+				}
 			}
 
 			policy.NormalizedTags = netpol.NormalizedTags
@@ -99,17 +162,23 @@ func ConvertToNetworkRuleSetPolicies(
 	if netpol.ApplyPolicyMode == gaia.NetworkAccessPolicyApplyPolicyModeOutgoingTraffic ||
 		netpol.ApplyPolicyMode == gaia.NetworkAccessPolicyApplyPolicyModeBidirectional {
 		// Outgoing rule set policies
-		for _, subject := range netpol.Subject {
+		for j, subject := range netpol.Subject {
 
 			policy := networkRuleSetPolicy.DeepCopy()
 			policy.Subject = [][]string{subject}
 			policy.OutgoingRules = make([]*gaia.NetworkRule, len(netpol.Object))
+			if opts.Explain {
+				explainPolicy(policy, append(explainSource(netpol), explainClause("subject", "subject", j))...)
+			}
 
 			// Create a rule for each 'OR' clause
 			for i, object := range netpol.Object {
 				rule := networkRule.DeepCopy()
 				rule.Object = [][]string{object}
 				policy.OutgoingRules[i] = rule
+				if opts.Explain {
+					opts.provenance.add(rule, append(explainSource(netpol), explainClause("object", "object", i))...)
+				}
 			}
 
 			policy.NormalizedTags = netpol.NormalizedTags
@@ -117,125 +186,365 @@ func ConvertToNetworkRuleSetPolicies(
 		}
 	}
 
-	outExtNetList = addExternalNetworkToPolicies(outNetPolList, extnet)
+	// Only the external networks visible where the policy applies can be selected
+	outExtNetList, report, err := addExternalNetworkToPolicies(outNetPolList, selectableExternalNetworks(extnet, netpol), opts)
+	if err != nil {
+		return nil, nil, nil, NewPolicyError(netpol, err)
+	}
+
+	// An external network selected by several rules is reported once
+	reported := map[string]struct{}{}
+	for _, p := range report.invalidPorts {
+		msg := fmt.Sprintf("invalid service port %s of external network %s", p.port, p.externalNetwork)
+		if _, ok := reported[msg]; ok {
+			continue
+		}
+		reported[msg] = struct{}{}
+		warnings = append(warnings, newWarning(netpol, WarningInvalidPort, "%s left out of the intersections", msg))
+		invalidPorts = append(invalidPorts, msg)
+	}
+
+	if opts.Strict && len(invalidPorts) != 0 {
+		return nil, nil, nil, NewPolicyError(netpol, fmt.Errorf("%w: %s", ErrInvalidPort, strings.Join(invalidPorts, ", ")))
+	}
+
+	for _, d := range report.dropped {
+		warnings = append(warnings, newWarning(netpol, WarningIneffectiveRuleDropped, "rule to external network %s dropped: ports [%s] do not overlap service ports [%s]", d.externalNetwork, strings.Join(d.ports, ", "), strings.Join(d.servicePorts, ", ")))
+	}
+
+	if len(report.dropped) != 0 {
+		outNetPolList = removeEmptyPolicies(outNetPolList)
+	}
+
+	splitPolicyRules(outNetPolList, opts.MultiportLimit, opts.provenance)
+
+	opts.Logger.Debug("converted network access policy",
+		zap.Int("ruleSetPolicies", len(outNetPolList)),
+		zap.Int("externalNetworks", len(outExtNetList)),
+	)
+
+	if opts.Deterministic {
+		canonicalizePolicies(outNetPolList)
+		canonicalizeExternalNetworks(outExtNetList)
+		SortExternalNetworks(outExtNetList)
+	}
+
+	// The rules are in their final order
+	opts.provenance.annotate(outNetPolList)
+
+	return outNetPolList, outExtNetList, warnings, nil
+}
+
+// CheckExternalNetworks verifies that the external networks can be used for a conversion.
+func CheckExternalNetworks(extnet gaia.ExternalNetworksList) error {
+
+	if duplicates := DuplicateExternalNetworks(extnet); len(duplicates) != 0 {
+		return fmt.Errorf("%w: %s", ErrDuplicateName, quoteExternalNetwork(duplicates[0]))
+	}
+
+	return nil
+}
+
+// DuplicateExternalNetworks returns the external networks sharing their name with another
+// external network of the same namespace.
+func DuplicateExternalNetworks(extnet gaia.ExternalNetworksList) gaia.ExternalNetworksList {
+
+	count := map[string]int{}
+	for _, e := range extnet {
+		count[externalNetworkID(e)]++
+	}
+
+	duplicates := gaia.ExternalNetworksList{}
+	for _, e := range extnet {
+		if count[externalNetworkID(e)] > 1 {
+			duplicates = append(duplicates, e)
+		}
+	}
+
+	return duplicates
+}
+
+// CheckDuplicateExternalNetworks returns an error wrapping ErrDuplicateName if a clause of the
+// policy selects one of the duplicate external networks returned by DuplicateExternalNetworks:
+// the rules selecting them could not tell them apart. The policies selecting none of them can
+// be converted.
+func CheckDuplicateExternalNetworks(netpol *gaia.NetworkAccessPolicy, duplicates gaia.ExternalNetworksList) error {
+
+	if len(duplicates) == 0 {
+		return nil
+	}
+
+	selectable := selectableExternalNetworks(duplicates, netpol)
+
+	for _, clause := range append(append([][]string{}, netpol.Subject...), netpol.Object...) {
+		for _, extnet := range selectable {
+			// The clauses that cannot be matched are reported by the conversion
+			if matched, err := externalNetworksMatchTags(extnet, clause); err == nil && matched {
+				return fmt.Errorf("%w: %s", ErrDuplicateName, quoteExternalNetwork(extnet))
+			}
+		}
+	}
 
-	return outNetPolList, outExtNetList
+	return nil
+}
+
+// convertObservation returns the observation mode of the network rules of a network access policy.
+//
+// An observed network rule only reports the traffic it matches, which is then
+// decided by the other rules. This is the behavior of an observed policy with
+// the Continue observed traffic action. An observed policy with the Apply
+// observed traffic action enforces its action, so its rules are not observed.
+func convertObservation(netpol *gaia.NetworkAccessPolicy) (bool, *Warning) {
+
+	if !netpol.ObservationEnabled {
+		return false, nil
+	}
+
+	switch netpol.ObservedTrafficAction {
+	case gaia.NetworkAccessPolicyObservedTrafficActionContinue:
+		return true, nil
+	case gaia.NetworkAccessPolicyObservedTrafficActionApply:
+		return false, newWarning(netpol, WarningObservedTrafficApplied, "observed traffic action Apply: rules enforced without observation")
+	default:
+		return true, newWarning(netpol, WarningUnknownObservedTrafficAction, "unknown observed traffic action '%s': rules observed without being enforced", netpol.ObservedTrafficAction)
+	}
+}
+
+// checkActivation returns a warning for each time based setting of a network access policy.
+// Rule set policies have no activation schedule nor expiration: they are always active. So a
+// policy that expired before now gives disabled rule set policies, and a policy only active on
+// a schedule gives disabled rule set policies tagged for review.
+func checkActivation(netpol *gaia.NetworkAccessPolicy, now time.Time) (expired bool, scheduled bool, warnings []*Warning) {
+
+	if netpol.ActiveSchedule != "" || netpol.ActiveDuration != "" {
+		scheduled = true
+		warnings = append(warnings, newWarning(netpol, WarningActivationSchedule, "active on schedule '%s' for '%s': rule set policies generated disabled with the tag '%s' for manual review", netpol.ActiveSchedule, netpol.ActiveDuration, ReviewTag))
+	}
+
+	switch {
+	case netpol.ExpirationTime.IsZero():
+	case !netpol.ExpirationTime.After(now):
+		expired = true
+		warnings = append(warnings, newWarning(netpol, WarningExpirationTime, "expired at %s: rule set policies generated disabled", netpol.ExpirationTime.UTC().Format(time.RFC3339)))
+	default:
+		warnings = append(warnings, newWarning(netpol, WarningExpirationTime, "expires at %s: rule set policies do not expire", netpol.ExpirationTime.UTC().Format(time.RFC3339)))
+	}
+
+	return expired, scheduled, warnings
 }
 
 // convertNetPolActionToNetRuleAction converts a network access policy action into its corresponding network rule action.
-func convertToNetworkRuleAction(action gaia.NetworkAccessPolicyActionValue) gaia.NetworkRuleActionValue {
+func convertToNetworkRuleAction(action gaia.NetworkAccessPolicyActionValue) (gaia.NetworkRuleActionValue, error) {
 
 	switch action {
 	case gaia.NetworkAccessPolicyActionAllow:
-		return gaia.NetworkRuleActionAllow
+		return gaia.NetworkRuleActionAllow, nil
 	case gaia.NetworkAccessPolicyActionReject:
-		return gaia.NetworkRuleActionReject
+		return gaia.NetworkRuleActionReject, nil
 	default:
-		panic(fmt.Sprintf("unsupported network access policy action: '%s'", action))
+		return "", fmt.Errorf("%w: '%s'", ErrUnsupportedAction, action)
 	}
 }
 
+// ineffectiveRule describes a rule dropped because it matches no traffic.
+type ineffectiveRule struct {
+	externalNetwork string
+	ports           []string
+	servicePorts    []string
+}
+
+// invalidServicePort describes a service port of an external network left out of the
+// intersections because it cannot be parsed.
+type invalidServicePort struct {
+	externalNetwork string
+	port            intersection.InvalidProtocolPort
+}
+
+// expansionReport holds what the expansion of the rules against the external networks
+// leaves out of the generated rules, and the generated rules to record on their policy.
+type expansionReport struct {
+	dropped      []ineffectiveRule
+	invalidPorts []invalidServicePort
+	expanded     []expandedRule
+}
+
+// merge appends what the other report leaves out of the generated rules. The expanded
+// rules are recorded on their policy by addExternalNetworks.
+func (r *expansionReport) merge(other expansionReport) {
+	r.dropped = append(r.dropped, other.dropped...)
+	r.invalidPorts = append(r.invalidPorts, other.invalidPorts...)
+}
+
 func addExternalNetworkToPolicies(
 	netpols gaia.NetworkRuleSetPoliciesList,
 	extnets gaia.ExternalNetworksList,
+	opts Options,
 ) (
 	outExtNetList gaia.ExternalNetworksList,
+	report expansionReport,
+	err error,
 ) {
 	for _, policy := range netpols {
-		networks := addExternalNetworks(policy, extnets)
+		networks, r, err := addExternalNetworks(policy, extnets, opts)
+		if err != nil {
+			return nil, report, err
+		}
 		outExtNetList = append(outExtNetList, networks...)
+		report.merge(r)
 	}
-	return outExtNetList
+	return outExtNetList, report, nil
 }
 
 // addExternalNetworks looks up the relevant external networks and returns the union of ports and protocols as actions.
-func addExternalNetworks(policy *gaia.NetworkRuleSetPolicy, extnets gaia.ExternalNetworksList) (networks gaia.ExternalNetworksList) {
+func addExternalNetworks(policy *gaia.NetworkRuleSetPolicy, extnets gaia.ExternalNetworksList, opts Options) (networks gaia.ExternalNetworksList, report expansionReport, err error) {
 
 	rules := []*gaia.NetworkRule{}
 	networks = gaia.ExternalNetworksList{}
 	for _, rule := range policy.IncomingRules {
-		expandedRules, expandedNetworks := expandNetworkRule(rule, extnets)
+		expandedRules, expandedNetworks, r, err := expandNetworkRule(rule, extnets, opts)
+		if err != nil {
+			return nil, report, err
+		}
 		rules = append(rules, expandedRules...)
 		networks = append(networks, expandedNetworks...)
+		annotateExpandedRules(policy, r.expanded)
+		report.merge(r)
 	}
 	policy.IncomingRules = rules
 
 	rules = []*gaia.NetworkRule{}
 	for _, rule := range policy.OutgoingRules {
-		expandedRules, expandedNetworks := expandNetworkRule(rule, extnets)
+		expandedRules, expandedNetworks, r, err := expandNetworkRule(rule, extnets, opts)
+		if err != nil {
+			return nil, report, err
+		}
 		rules = append(rules, expandedRules...)
 		networks = append(networks, expandedNetworks...)
+		annotateExpandedRules(policy, r.expanded)
+		report.merge(r)
 	}
 	policy.OutgoingRules = rules
-	return networks
+	return networks, report, nil
 }
 
-func externalNetworksMatchTags(extnet *gaia.ExternalNetwork, tags []string) bool {
-
-	for _, tag := range tags {
-		matched := false
+// removeEmptyPolicies returns the policies that still hold rules.
+func removeEmptyPolicies(netpols gaia.NetworkRuleSetPoliciesList) gaia.NetworkRuleSetPoliciesList {
 
-		// Policy has some other identity match than $identity=externalnetwork. This set of tags can not match an external network
-		if strings.HasPrefix(tag, "$identity=") && !strings.EqualFold(tag, externalNetworkKey) {
-			return false
+	out := gaia.NetworkRuleSetPoliciesList{}
+	for _, policy := range netpols {
+		if len(policy.IncomingRules) != 0 || len(policy.OutgoingRules) != 0 {
+			out = append(out, policy)
 		}
+	}
 
-		// Policy has namespace match
-		if strings.HasPrefix(tag, "$namespace=") {
+	return out
+}
+
+// externalNetworksMatchTags returns true if the external network matches all the tags of a clause.
+// Metadata tags such as '$id=', '$name=' or '$identity=' are matched against the attributes of
+// the external network, see ExternalNetworkMetadataTags. A clause selecting another identity,
+// or holding a metadata tag external networks do not carry, like the '$image=' of processing
+// units, selects no external network. It only fails on a clause selecting external networks
+// by an attribute whose value is not known, like the '$id=' of a network in an export.
+func externalNetworksMatchTags(extnet *gaia.ExternalNetwork, tags []string) (bool, error) {
+
+	if selectsOtherIdentity(tags) {
+		return false, nil
+	}
+
+	var metadata []string
+
+	for _, tag := range tags {
+
+		// Identities are case insensitive
+		if strings.EqualFold(tag, externalNetworkKey) {
 			continue
 		}
 
-		// Policy has id match
-		if strings.HasPrefix(tag, "$id=") {
+		// Policy has namespace match, which can only be checked if the namespace of the external network is known
+		if strings.HasPrefix(tag, namespacePrefix) && extnet.Namespace == "" {
 			continue
 		}
 
-		// Some unknown $ match, panic here as opposed to recovering
 		if strings.HasPrefix(tag, "$") {
-			panic("unhandled tag")
-		}
 
-		for _, etag := range extnet.AssociatedTags {
-			if etag == tag {
-				matched = true
-				break
+			if metadata == nil {
+				metadata = ExternalNetworkMetadataTags(extnet)
+			}
+
+			matched, known := matchMetadataTag(metadata, tag)
+			if matched {
+				continue
 			}
+
+			// An attribute of an external network explicitly selected that the export does not
+			// hold, fail here as opposed to guessing
+			if !known && containsTagFold(tags, externalNetworkKey) && unknownExternalNetworkAttribute(extnet, tag) {
+				return false, fmt.Errorf("%w: '%s'", ErrUnknownTag, tag)
+			}
+
+			return false, nil
 		}
-		if !matched {
-			return false
+
+		if !containsTag(extnet.AssociatedTags, tag) {
+			return false, nil
 		}
 	}
-	return true
+	return true, nil
 }
 
-func getMatchingExternalNetworks(objects [][]string, extnets gaia.ExternalNetworksList) (match gaia.ExternalNetworksList) {
+// getMatchingExternalNetworks returns a copy of the external networks matching the objects,
+// with the marker tag added to their tags unless it is empty.
+func getMatchingExternalNetworks(objects [][]string, extnets gaia.ExternalNetworksList, markerTag string) (match gaia.ExternalNetworksList, err error) {
 
 	for _, extnet := range extnets {
 		matched := false
 		for _, object := range objects {
-			if externalNetworksMatchTags(extnet, object) {
-				matched = true
+			if matched, err = externalNetworksMatchTags(extnet, object); err != nil {
+				return nil, err
+			}
+			if matched {
 				break
 			}
 		}
 		if matched {
 			extnetCopy := extnet.DeepCopy()
-			extnetCopy.AssociatedTags = append(extnetCopy.AssociatedTags, "version=v2")
+			if markerTag != "" {
+				extnetCopy.AssociatedTags = append(extnetCopy.AssociatedTags, markerTag)
+			}
 			match = append(match, extnetCopy)
 		}
 	}
-	return match
+	return match, nil
 }
 
 // expandNetworkRule takes the intersection of each related external network's protocols/ports with the network rule and makes a new rule for each external network.
-func expandNetworkRule(rule *gaia.NetworkRule, extnets gaia.ExternalNetworksList) ([]*gaia.NetworkRule, gaia.ExternalNetworksList) {
+// With the DropIneffective option, the rules matching no traffic are reported as dropped instead.
+// The service ports left out of the intersections because they cannot be parsed are reported as well.
+func expandNetworkRule(rule *gaia.NetworkRule, extnets gaia.ExternalNetworksList, opts Options) ([]*gaia.NetworkRule, gaia.ExternalNetworksList, expansionReport, error) {
 
-	matchingExtNets := getMatchingExternalNetworks(rule.Object, extnets)
+	report := expansionReport{}
+	logger := opts.logger()
+
+	matchingExtNets, err := getMatchingExternalNetworks(rule.Object, extnets, opts.MarkerTag)
+	if err != nil {
+		return nil, nil, report, err
+	}
 
 	if len(matchingExtNets) == 0 {
-		return []*gaia.NetworkRule{rule}, matchingExtNets
+		logger.Debug("rule matches no external network", zap.Any("object", rule.Object))
+		return []*gaia.NetworkRule{rule}, matchingExtNets, report, nil
 	}
 
+	names := make([]string, len(matchingExtNets))
+	for i, externalNetwork := range matchingExtNets {
+		names[i] = externalNetworkID(externalNetwork)
+	}
+	logger.Debug("rule matches external networks", zap.Any("object", rule.Object), zap.Strings("externalNetworks", names))
+
+	// The ports before the expansion are recorded for the downgrade, see ExpandedRuleAnnotation
+	ports := append([]string{}, rule.ProtocolPorts...)
+
 	// Create a map to avoid duplicate entries
 	protocolsAndPorts := map[string]struct{}{}
 
@@ -255,6 +564,7 @@ func expandNetworkRule(rule *gaia.NetworkRule, extnets gaia.ExternalNetworksList
 	}
 
 	rules := []*gaia.NetworkRule{}
+	networks := gaia.ExternalNetworksList{}
 
 	for _, externalNetwork := range matchingExtNets {
 
@@ -271,60 +581,108 @@ func expandNetworkRule(rule *gaia.NetworkRule, extnets gaia.ExternalNetworksList
 			externalNetwork.ServicePorts = []string{anyKey}
 		}
 
-		protocolAndPorts := protocolPortsIntersection(rule.ProtocolPorts, externalNetwork.ServicePorts)
+		protocolAndPorts, invalid := protocolPortsIntersection(opts.Logger, rule.ProtocolPorts, externalNetwork.ServicePorts)
+		logger.Debug("intersected ports with service ports",
+			zap.String("externalNetwork", externalNetworkID(externalNetwork)),
+			zap.Strings("ports", rule.ProtocolPorts),
+			zap.Strings("servicePorts", externalNetwork.ServicePorts),
+			zap.Strings("intersection", protocolAndPorts),
+		)
+		for _, p := range invalid {
+			report.invalidPorts = append(report.invalidPorts, invalidServicePort{
+				externalNetwork: quoteExternalNetwork(externalNetwork),
+				port:            p,
+			})
+		}
+
+		if len(protocolAndPorts) == 0 && opts.DropIneffective {
+			logger.Debug("rule dropped as ineffective", zap.String("externalNetwork", externalNetworkID(externalNetwork)))
+			report.dropped = append(report.dropped, ineffectiveRule{
+				externalNetwork: quoteExternalNetwork(externalNetwork),
+				ports:           rule.ProtocolPorts,
+				servicePorts:    externalNetwork.ServicePorts,
+			})
+			continue
+		}
 
 		newRule := rule.DeepCopy()
 		for i, objects := range newRule.Object {
-			// Remove externalnetwork and id tag if exists in list
+			// Remove externalnetwork and id tag if exists in list, the v2 copy gets a new ID and is selected by name
 			o := objects[:0]
 			for _, object := range objects {
-				if strings.EqualFold(object, externalNetworkKey) {
+				if strings.EqualFold(object, externalNetworkKey) || strings.HasPrefix(object, "$id=") {
 					continue
 				}
 
 				o = append(o, object)
 			}
 
-			newRule.Object[i] = append(o, externalNetworkKey, "$name="+externalNetwork.Name, "version=v2")
+			o = append(o, externalNetworkKey)
+			if !containsTag(o, "$name="+externalNetwork.Name) {
+				o = append(o, "$name="+externalNetwork.Name)
+			}
+			// The name of an external network is only unique in its namespace
+			if externalNetwork.Namespace != "" && !containsTag(o, namespacePrefix+externalNetwork.Namespace) {
+				o = append(o, namespacePrefix+externalNetwork.Namespace)
+			}
+			if opts.MarkerTag != "" {
+				o = append(o, opts.MarkerTag)
+			}
+			newRule.Object[i] = o
+
+			report.expanded = append(report.expanded, expandedRule{
+				Object: append([]string{}, o...),
+				Source: append([]string{}, rule.Object[i]...),
+				Ports:  ports,
+			})
 		}
 
 		newRule.ProtocolPorts = protocolAndPorts
+		if opts.Explain {
+			opts.provenance.derive(rule, newRule,
+				"externalNetwork="+externalNetworkID(externalNetwork),
+				explainPorts("ports", rule.ProtocolPorts),
+				explainPorts("servicePorts", externalNetwork.ServicePorts),
+				explainPorts("intersectedPorts", protocolAndPorts),
+			)
+		}
 
 		// This rule is ineffective, label as such
-		if len(newRule.ProtocolPorts) == 0 {
-			newRule.Object = append(newRule.Object, []string{ineffectiveKey})
+		if len(newRule.ProtocolPorts) == 0 && opts.IneffectiveTag != "" {
+			logger.Debug("rule marked as ineffective", zap.String("externalNetwork", externalNetworkID(externalNetwork)), zap.String("tag", opts.IneffectiveTag))
+			newRule.Object = append(newRule.Object, []string{opts.IneffectiveTag})
 		}
 
 		rules = append(rules, newRule)
+		networks = append(networks, externalNetwork)
 	}
 
-	if len(rules) == 0 {
-		return []*gaia.NetworkRule{rule}, matchingExtNets
-	}
-
-	return rules, matchingExtNets
+	return rules, networks, report, nil
 }
 
-// intersection finds and returns the intersection of ports across protocols
-func protocolPortsIntersection(ruleProtocolPorts []string, extnetProtocolPorts []string) []string {
+// intersection finds and returns the intersection of ports across protocols.
+// The service ports that cannot be parsed are left out and returned as invalid.
+func protocolPortsIntersection(logger *zap.Logger, ruleProtocolPorts []string, extnetProtocolPorts []string) ([]string, []intersection.InvalidProtocolPort) {
+
+	extnetProtocolPorts, invalid := intersection.FilterProtocolPorts(extnetProtocolPorts)
 
 	icmps, extnetProtoPortsSubset, ruleProtoPortsSubset := intersection.IntersectedICMP(extnetProtocolPorts, ruleProtocolPorts)
 
-	miscProtocols, _ := intersection.ExtractProtocolsPorts("", extnetProtoPortsSubset, ruleProtoPortsSubset)
+	miscProtocols, _ := intersection.ExtractProtocolsPortsWithLogger(logger, "", extnetProtoPortsSubset, ruleProtoPortsSubset)
 
 	// If 'any' is part of miscProtocols, then we are done
 	for _, protocol := range miscProtocols {
 		if strings.EqualFold(protocol, anyKey) {
-			return []string{protocol}
+			return []string{protocol}, invalid
 		}
 	}
 
-	_, tcpPorts := intersection.ExtractProtocolsPorts(protocols.L4ProtocolTCP, extnetProtoPortsSubset, ruleProtoPortsSubset)
+	_, tcpPorts := intersection.ExtractProtocolsPortsWithLogger(logger, protocols.L4ProtocolTCP, extnetProtoPortsSubset, ruleProtoPortsSubset)
 	for i, tcpPort := range tcpPorts {
 		tcpPorts[i] = fmt.Sprintf("tcp/%s", tcpPort)
 	}
 
-	_, udpPorts := intersection.ExtractProtocolsPorts(protocols.L4ProtocolUDP, extnetProtoPortsSubset, ruleProtoPortsSubset)
+	_, udpPorts := intersection.ExtractProtocolsPortsWithLogger(logger, protocols.L4ProtocolUDP, extnetProtoPortsSubset, ruleProtoPortsSubset)
 	for i, udpPort := range udpPorts {
 		udpPorts[i] = fmt.Sprintf("udp/%s", udpPort)
 	}
@@ -335,5 +693,5 @@ func protocolPortsIntersection(ruleProtocolPorts []string, extnetProtocolPorts [
 
 	sort.Strings(intersectedProtocolPorts)
 
-	return intersectedProtocolPorts
+	return intersectedProtocolPorts, invalid
 }
@@ -1,33 +1,51 @@
 package rulesetpolicies
 
 import (
+	"errors"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
 
 	"go.aporeto.io/gaia"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func Test_convertToNetworkRuleAction(t *testing.T) {
 
 	tests := []struct {
-		name   string
-		action gaia.NetworkAccessPolicyActionValue
-		want   gaia.NetworkRuleActionValue
+		name    string
+		action  gaia.NetworkAccessPolicyActionValue
+		want    gaia.NetworkRuleActionValue
+		wantErr error
 	}{
 		{
 			"allow",
 			gaia.NetworkAccessPolicyActionAllow,
 			gaia.NetworkRuleActionAllow,
+			nil,
 		},
 		{
 			"reject",
 			gaia.NetworkAccessPolicyActionReject,
 			gaia.NetworkRuleActionReject,
+			nil,
+		},
+		{
+			"continue",
+			gaia.NetworkAccessPolicyActionContinue,
+			"",
+			ErrUnsupportedAction,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got := convertToNetworkRuleAction(tt.action)
+			got, err := convertToNetworkRuleAction(tt.action)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("convertToNetworkRuleAction() error = %v, wantErr %v", err, tt.wantErr)
+			}
 			if !reflect.DeepEqual(got, tt.want) {
 				t.Errorf("convertToNetworkRuleAction() = %v, want %v", got, tt.want)
 			}
@@ -46,9 +64,13 @@ func Test_getMatchingExternalNetworks(t *testing.T) {
 		AssociatedTags: []string{"c"},
 	}
 
+	en1v2 := en1.DeepCopy()
+	en1v2.AssociatedTags = []string{"a", "version=v2"}
+
 	type args struct {
-		objects [][]string
-		extnets gaia.ExternalNetworksList
+		objects   [][]string
+		extnets   gaia.ExternalNetworksList
+		markerTag string
 	}
 	tests := []struct {
 		name      string
@@ -88,10 +110,30 @@ func Test_getMatchingExternalNetworks(t *testing.T) {
 				en2,
 			},
 		},
+		{
+			name: "match with marker tag",
+			args: args{
+				objects: [][]string{
+					{"a"},
+				},
+				extnets: gaia.ExternalNetworksList{
+					en1,
+					en2,
+				},
+				markerTag: "version=v2",
+			},
+			wantMatch: gaia.ExternalNetworksList{
+				en1v2,
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if gotMatch := getMatchingExternalNetworks(tt.args.objects, tt.args.extnets); !reflect.DeepEqual(gotMatch, tt.wantMatch) {
+			gotMatch, err := getMatchingExternalNetworks(tt.args.objects, tt.args.extnets, tt.args.markerTag)
+			if err != nil {
+				t.Fatalf("getMatchingExternalNetworks() error = %v", err)
+			}
+			if !reflect.DeepEqual(gotMatch, tt.wantMatch) {
 				t.Errorf("getMatchingExternalNetworks() = %v, want %v", gotMatch, tt.wantMatch)
 			}
 		})
@@ -105,14 +147,24 @@ func Test_externalNetworksMatchTags(t *testing.T) {
 		AssociatedTags: []string{"a", "b"},
 	}
 
+	en2 := &gaia.ExternalNetwork{
+		ID:             "5f8e",
+		Name:           "en2",
+		Namespace:      "/ns",
+		Propagate:      true,
+		AssociatedTags: []string{"a"},
+		NormalizedTags: []string{"a", "$custom=x"},
+	}
+
 	type args struct {
 		extnet *gaia.ExternalNetwork
 		tags   []string
 	}
 	tests := []struct {
-		name string
-		args args
-		want bool
+		name    string
+		args    args
+		want    bool
+		wantErr error
 	}{
 		{
 			name: "match basic",
@@ -138,10 +190,143 @@ func Test_externalNetworksMatchTags(t *testing.T) {
 			},
 			want: false,
 		},
+		{
+			name: "metadata tag of another identity",
+			args: args{
+				en1,
+				[]string{"a", "$image=nginx"},
+			},
+			want: false,
+		},
+		{
+			name: "metadata tag before another identity",
+			args: args{
+				en1,
+				[]string{"$id=5f8e", "$identity=processingunit"},
+			},
+			want: false,
+		},
+		{
+			name: "identity",
+			args: args{
+				en1,
+				[]string{"$identity=ExternalNetwork", "a"},
+			},
+			want: true,
+		},
+		{
+			name: "other identity",
+			args: args{
+				en1,
+				[]string{"$identity=processingunit", "a"},
+			},
+			want: false,
+		},
+		{
+			name: "name",
+			args: args{
+				en1,
+				[]string{"$identity=externalnetwork", "$name=en1"},
+			},
+			want: true,
+		},
+		{
+			name: "other name",
+			args: args{
+				en1,
+				[]string{"$identity=externalnetwork", "$name=en2"},
+			},
+			want: false,
+		},
+		{
+			name: "id",
+			args: args{
+				en2,
+				[]string{"$id=5f8e"},
+			},
+			want: true,
+		},
+		{
+			name: "other id",
+			args: args{
+				en2,
+				[]string{"$id=5f8f"},
+			},
+			want: false,
+		},
+		{
+			name: "id without ids in the export",
+			args: args{
+				en1,
+				[]string{"$id=5f8e"},
+			},
+			want: false,
+		},
+		{
+			name: "external network id without ids in the export",
+			args: args{
+				en1,
+				[]string{"$identity=externalnetwork", "$id=5f8e"},
+			},
+			want:    false,
+			wantErr: ErrUnknownTag,
+		},
+		{
+			name: "namespace",
+			args: args{
+				en2,
+				[]string{"a", "$namespace=/ns"},
+			},
+			want: true,
+		},
+		{
+			name: "namespace without namespaces in the export",
+			args: args{
+				en1,
+				[]string{"a", "$namespace=/ns"},
+			},
+			want: true,
+		},
+		{
+			name: "attribute",
+			args: args{
+				en2,
+				[]string{"a", "$propagate=true"},
+			},
+			want: true,
+		},
+		{
+			name: "other attribute",
+			args: args{
+				en1,
+				[]string{"a", "$propagate=true"},
+			},
+			want: false,
+		},
+		{
+			name: "normalized tag",
+			args: args{
+				en2,
+				[]string{"$custom=x"},
+			},
+			want: true,
+		},
+		{
+			name: "other normalized tag",
+			args: args{
+				en2,
+				[]string{"$custom=y"},
+			},
+			want: false,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if got := externalNetworksMatchTags(tt.args.extnet, tt.args.tags); got != tt.want {
+			got, err := externalNetworksMatchTags(tt.args.extnet, tt.args.tags)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("externalNetworksMatchTags() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
 				t.Errorf("externalNetworksMatchTags() = %v, want %v", got, tt.want)
 			}
 		})
@@ -507,7 +692,10 @@ func TestConvertToNetworkRuleSetPolicies(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotOutNetPolList, gotOutExtNetList := ConvertToNetworkRuleSetPolicies(tt.args.netpol, tt.args.extnet)
+			gotOutNetPolList, gotOutExtNetList, _, err := ConvertToNetworkRuleSetPolicies(tt.args.netpol, tt.args.extnet, DefaultOptions())
+			if err != nil {
+				t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+			}
 			if len(gotOutNetPolList) != len(tt.wantOutNetPolList) {
 				t.Errorf("ConvertToNetworkRuleSetPolicies() len(gotOutNetPolList) = %v, doesn't match len(tt.wantOutNetPolList) %v", len(gotOutExtNetList), len(tt.wantOutNetPolList))
 			}
@@ -600,6 +788,976 @@ func TestConvertToNetworkRuleSetPolicies(t *testing.T) {
 	}
 }
 
+func TestConvertToNetworkRuleSetPoliciesErrors(t *testing.T) {
+
+	newPolicy := func(action gaia.NetworkAccessPolicyActionValue, object []string) *gaia.NetworkAccessPolicy {
+		netpol := gaia.NewNetworkAccessPolicy()
+		netpol.Name = "name"
+		netpol.Namespace = "namespace"
+		netpol.ApplyPolicyMode = gaia.NetworkAccessPolicyApplyPolicyModeOutgoingTraffic
+		netpol.Action = action
+		netpol.Subject = [][]string{{"app=foo"}}
+		netpol.Object = [][]string{object}
+		return netpol
+	}
+
+	type args struct {
+		netpol *gaia.NetworkAccessPolicy
+		extnet gaia.ExternalNetworksList
+	}
+	tests := []struct {
+		name    string
+		args    args
+		wantErr error
+	}{
+		{
+			name: "unsupported action",
+			args: args{
+				netpol: newPolicy(gaia.NetworkAccessPolicyActionValue("Drop"), []string{"app=bar"}),
+				extnet: gaia.ExternalNetworksList{},
+			},
+			wantErr: ErrUnsupportedAction,
+		},
+		{
+			name: "unknown tag",
+			args: args{
+				netpol: newPolicy(gaia.NetworkAccessPolicyActionAllow, []string{"$identity=externalnetwork", "$id=5f8e"}),
+				extnet: gaia.ExternalNetworksList{
+					{Name: "x", AssociatedTags: []string{"app=bar"}},
+				},
+			},
+			wantErr: ErrUnknownTag,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, _, _, err := ConvertToNetworkRuleSetPolicies(tt.args.netpol, tt.args.extnet, DefaultOptions())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			var perr *PolicyError
+			if !errors.As(err, &perr) {
+				t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %T, want *PolicyError", err)
+			}
+			if perr.Name != tt.args.netpol.Name || perr.Namespace != tt.args.netpol.Namespace {
+				t.Errorf("ConvertToNetworkRuleSetPolicies() error policy = %s/%s", perr.Namespace, perr.Name)
+			}
+		})
+	}
+}
+
+func TestCheckDuplicateExternalNetworks(t *testing.T) {
+
+	extnets := gaia.ExternalNetworksList{
+		{Name: "x", AssociatedTags: []string{"app=bar"}},
+		{Name: "x", AssociatedTags: []string{"app=baz"}},
+		{Name: "y", AssociatedTags: []string{"app=qux"}},
+		{Name: "y", Namespace: "/other", AssociatedTags: []string{"app=qux"}},
+	}
+
+	duplicates := DuplicateExternalNetworks(extnets)
+	if len(duplicates) != 2 || duplicates[0] != extnets[0] || duplicates[1] != extnets[1] {
+		t.Fatalf("DuplicateExternalNetworks() = %v, want the two x", duplicates)
+	}
+
+	newPolicy := func(object ...string) *gaia.NetworkAccessPolicy {
+		netpol := gaia.NewNetworkAccessPolicy()
+		netpol.Name = "name"
+		netpol.Subject = [][]string{{"app=foo"}}
+		netpol.Object = [][]string{object}
+		return netpol
+	}
+
+	tests := []struct {
+		name    string
+		netpol  *gaia.NetworkAccessPolicy
+		wantErr error
+	}{
+		{"selects one of the duplicates", newPolicy("app=bar"), ErrDuplicateName},
+		{"selects another external network", newPolicy("app=qux"), nil},
+		{"selects processing units", newPolicy("app=foo"), nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckDuplicateExternalNetworks(tt.netpol, duplicates); !errors.Is(err, tt.wantErr) {
+				t.Errorf("CheckDuplicateExternalNetworks() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// Duplicates are only checked by the caller
+	if _, _, _, err := ConvertToNetworkRuleSetPolicies(newPolicy("app=qux"), extnets, DefaultOptions()); err != nil {
+		t.Errorf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+	}
+}
+
+func TestConvertToNetworkRuleSetPoliciesContinue(t *testing.T) {
+
+	netpol := gaia.NewNetworkAccessPolicy()
+	netpol.Name = "name"
+	netpol.Namespace = "namespace"
+	netpol.Action = gaia.NetworkAccessPolicyActionContinue
+	netpol.AssociatedTags = []string{"team=a"}
+	netpol.Subject = [][]string{{"app=foo"}}
+	netpol.Object = [][]string{{"app=bar"}}
+	netpol.Ports = []string{"tcp/80"}
+
+	t.Run("fallthrough", func(t *testing.T) {
+
+		rsl, netl, warnings, err := ConvertToNetworkRuleSetPolicies(netpol, gaia.ExternalNetworksList{}, DefaultOptions())
+		if err != nil {
+			t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+		}
+		if len(rsl) != 0 || len(netl) != 0 {
+			t.Errorf("ConvertToNetworkRuleSetPolicies() = %v, %v, want no objects", rsl, netl)
+		}
+		if len(warnings) != 1 || warnings[0].Code != WarningContinueAction || warnings[0].Name != "name" || warnings[0].Namespace != "namespace" {
+			t.Errorf("ConvertToNetworkRuleSetPolicies() warnings = %v, want one warning for the policy", warnings)
+		}
+	})
+
+	t.Run("zero options", func(t *testing.T) {
+
+		rsl, _, warnings, err := ConvertToNetworkRuleSetPolicies(netpol, gaia.ExternalNetworksList{}, Options{})
+		if err != nil {
+			t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+		}
+		if len(rsl) != 0 || len(warnings) != 1 || warnings[0].Code != WarningContinueAction {
+			t.Errorf("ConvertToNetworkRuleSetPolicies() = %v, %v, want the fallthrough strategy", rsl, warnings)
+		}
+	})
+
+	t.Run("review", func(t *testing.T) {
+
+		opts := DefaultOptions()
+		opts.ContinueStrategy = ContinueStrategyReview
+
+		rsl, _, warnings, err := ConvertToNetworkRuleSetPolicies(netpol, gaia.ExternalNetworksList{}, opts)
+		if err != nil {
+			t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+		}
+		if len(rsl) != 2 {
+			t.Fatalf("ConvertToNetworkRuleSetPolicies() = %d policies, want 2", len(rsl))
+		}
+		for _, policy := range rsl {
+			if !policy.Disabled {
+				t.Errorf("ConvertToNetworkRuleSetPolicies() policy %v is not disabled", policy)
+			}
+			if !matchTags([]string{"team=a", ReviewTag}, policy.AssociatedTags) {
+				t.Errorf("ConvertToNetworkRuleSetPolicies() associatedTags = %v", policy.AssociatedTags)
+			}
+			if values := policy.Annotations[DisabledAnnotation]; !reflect.DeepEqual(values, []string{"false"}) {
+				t.Errorf("ConvertToNetworkRuleSetPolicies() %s annotation = %v, want [false]", DisabledAnnotation, values)
+			}
+			for _, rule := range append(policy.IncomingRules, policy.OutgoingRules...) {
+				if rule.Action != gaia.NetworkRuleActionAllow {
+					t.Errorf("ConvertToNetworkRuleSetPolicies() rule action = %s, want Allow", rule.Action)
+				}
+			}
+		}
+		if len(warnings) != 1 {
+			t.Errorf("ConvertToNetworkRuleSetPolicies() warnings = %v, want one warning", warnings)
+		}
+		if !reflect.DeepEqual(netpol.AssociatedTags, []string{"team=a"}) {
+			t.Errorf("ConvertToNetworkRuleSetPolicies() modified the policy tags: %v", netpol.AssociatedTags)
+		}
+	})
+
+	t.Run("unknown strategy", func(t *testing.T) {
+
+		opts := DefaultOptions()
+		opts.ContinueStrategy = ContinueStrategy("ignore")
+
+		if _, _, _, err := ConvertToNetworkRuleSetPolicies(netpol, gaia.ExternalNetworksList{}, opts); !errors.Is(err, ErrUnsupportedAction) {
+			t.Errorf("ConvertToNetworkRuleSetPolicies() error = %v, want %v", err, ErrUnsupportedAction)
+		}
+	})
+}
+
+func TestConvertToNetworkRuleSetPoliciesObservation(t *testing.T) {
+
+	tests := []struct {
+		name                  string
+		observationEnabled    bool
+		observedTrafficAction gaia.NetworkAccessPolicyObservedTrafficActionValue
+		wantObservation       bool
+		wantWarning           WarningCode
+	}{
+		{
+			"not observed",
+			false,
+			gaia.NetworkAccessPolicyObservedTrafficActionApply,
+			false,
+			"",
+		},
+		{
+			"observed continue",
+			true,
+			gaia.NetworkAccessPolicyObservedTrafficActionContinue,
+			true,
+			"",
+		},
+		{
+			"observed apply",
+			true,
+			gaia.NetworkAccessPolicyObservedTrafficActionApply,
+			false,
+			WarningObservedTrafficApplied,
+		},
+		{
+			"observed unknown",
+			true,
+			gaia.NetworkAccessPolicyObservedTrafficActionValue("Drop"),
+			true,
+			WarningUnknownObservedTrafficAction,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			netpol := gaia.NewNetworkAccessPolicy()
+			netpol.Name = "name"
+			netpol.Namespace = "namespace"
+			netpol.Subject = [][]string{{"app=foo"}}
+			netpol.Object = [][]string{{"app=bar"}}
+			netpol.ObservationEnabled = tt.observationEnabled
+			netpol.ObservedTrafficAction = tt.observedTrafficAction
+
+			rsl, _, warnings, err := ConvertToNetworkRuleSetPolicies(netpol, gaia.ExternalNetworksList{}, DefaultOptions())
+			if err != nil {
+				t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+			}
+
+			if len(rsl) != 2 {
+				t.Fatalf("ConvertToNetworkRuleSetPolicies() = %d policies, want 2", len(rsl))
+			}
+			for _, policy := range rsl {
+				for _, rule := range append(policy.IncomingRules, policy.OutgoingRules...) {
+					if rule.ObservationEnabled != tt.wantObservation {
+						t.Errorf("ConvertToNetworkRuleSetPolicies() rule observationEnabled = %v, want %v", rule.ObservationEnabled, tt.wantObservation)
+					}
+				}
+			}
+
+			if tt.wantWarning == "" {
+				if len(warnings) != 0 {
+					t.Errorf("ConvertToNetworkRuleSetPolicies() warnings = %v, want none", warnings)
+				}
+				return
+			}
+			if len(warnings) != 1 || warnings[0].Code != tt.wantWarning {
+				t.Errorf("ConvertToNetworkRuleSetPolicies() warnings = %v, want %s", warnings, tt.wantWarning)
+			}
+		})
+	}
+}
+
+func TestConvertToNetworkRuleSetPoliciesTimes(t *testing.T) {
+
+	created := time.Date(2020, time.March, 1, 10, 0, 0, 0, time.UTC)
+	updated := time.Date(2021, time.June, 2, 11, 0, 0, 0, time.UTC)
+
+	netpol := gaia.NewNetworkAccessPolicy()
+	netpol.Name = "name"
+	netpol.Namespace = "namespace"
+	netpol.Subject = [][]string{{"app=foo"}}
+	netpol.Object = [][]string{{"app=bar"}}
+	netpol.CreateTime = created
+	netpol.UpdateTime = updated
+
+	t.Run("timestamps", func(t *testing.T) {
+
+		rsl, _, warnings, err := ConvertToNetworkRuleSetPolicies(netpol, gaia.ExternalNetworksList{}, DefaultOptions())
+		if err != nil {
+			t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+		}
+		for _, policy := range rsl {
+			if !policy.CreateTime.Equal(created) || !policy.UpdateTime.Equal(updated) {
+				t.Errorf("ConvertToNetworkRuleSetPolicies() times = %s %s, want %s %s", policy.CreateTime, policy.UpdateTime, created, updated)
+			}
+			// The export leaves the times out
+			want := map[string][]string{
+				CreateTimeAnnotation: {"2020-03-01T10:00:00Z"},
+				UpdateTimeAnnotation: {"2021-06-02T11:00:00Z"},
+			}
+			if !reflect.DeepEqual(policy.Annotations, want) {
+				t.Errorf("ConvertToNetworkRuleSetPolicies() annotations = %v, want %v", policy.Annotations, want)
+			}
+		}
+		if netpol.Annotations != nil {
+			t.Errorf("ConvertToNetworkRuleSetPolicies() modified the annotations of the policy: %v", netpol.Annotations)
+		}
+		if len(warnings) != 0 {
+			t.Errorf("ConvertToNetworkRuleSetPolicies() warnings = %v, want none", warnings)
+		}
+	})
+
+	t.Run("downgrade", func(t *testing.T) {
+
+		rsl, _, _, err := ConvertToNetworkRuleSetPolicies(netpol, gaia.ExternalNetworksList{}, DefaultOptions())
+		if err != nil {
+			t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+		}
+
+		// The times are restored from the annotations, as after an export
+		for _, policy := range rsl {
+			policy.CreateTime = time.Time{}
+			policy.UpdateTime = time.Time{}
+		}
+
+		npl, _, _, err := ConvertToNetworkAccessPolicies(rsl, nil, DefaultOptions())
+		if err != nil {
+			t.Fatalf("ConvertToNetworkAccessPolicies() error = %v", err)
+		}
+		if len(npl) != 1 {
+			t.Fatalf("ConvertToNetworkAccessPolicies() = %d policies, want 1", len(npl))
+		}
+		if !npl[0].CreateTime.Equal(created) || !npl[0].UpdateTime.Equal(updated) || npl[0].Annotations != nil {
+			t.Errorf("ConvertToNetworkAccessPolicies() times = %s %s, annotations = %v, want %s %s", npl[0].CreateTime, npl[0].UpdateTime, npl[0].Annotations, created, updated)
+		}
+	})
+
+	t.Run("activation", func(t *testing.T) {
+
+		scheduled := netpol.DeepCopy()
+		scheduled.ActiveSchedule = "0 8 * * 1-5"
+		scheduled.ActiveDuration = "10h"
+		scheduled.ExpirationTime = time.Now().AddDate(1, 0, 0)
+
+		rsl, _, warnings, err := ConvertToNetworkRuleSetPolicies(scheduled, gaia.ExternalNetworksList{}, DefaultOptions())
+		if err != nil {
+			t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+		}
+
+		codes := []WarningCode{}
+		for _, w := range warnings {
+			codes = append(codes, w.Code)
+		}
+		if want := []WarningCode{WarningActivationSchedule, WarningExpirationTime}; !reflect.DeepEqual(codes, want) {
+			t.Errorf("ConvertToNetworkRuleSetPolicies() warnings = %v, want %v", codes, want)
+		}
+
+		// The allow rules would be permanent
+		for _, policy := range rsl {
+			if !policy.Disabled || !containsTag(policy.AssociatedTags, ReviewTag) {
+				t.Errorf("ConvertToNetworkRuleSetPolicies() = %v, want disabled with the review tag", policy)
+			}
+			if values := policy.Annotations[ReviewActionAnnotation]; !reflect.DeepEqual(values, []string{"Allow"}) {
+				t.Errorf("ConvertToNetworkRuleSetPolicies() %s annotation = %v, want [Allow]", ReviewActionAnnotation, values)
+			}
+		}
+
+		npl, _, _, err := ConvertToNetworkAccessPolicies(rsl, nil, DefaultOptions())
+		if err != nil {
+			t.Fatalf("ConvertToNetworkAccessPolicies() error = %v", err)
+		}
+		if len(npl) != 1 || npl[0].Action != gaia.NetworkAccessPolicyActionAllow || npl[0].Disabled || containsTag(npl[0].AssociatedTags, ReviewTag) {
+			t.Errorf("ConvertToNetworkAccessPolicies() = %v, want the enabled Allow policy", npl)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+
+		expired := netpol.DeepCopy()
+		expired.ExpirationTime = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+		rsl, _, warnings, err := ConvertToNetworkRuleSetPolicies(expired, gaia.ExternalNetworksList{}, DefaultOptions())
+		if err != nil {
+			t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+		}
+
+		if len(warnings) != 1 || warnings[0].Code != WarningExpirationTime {
+			t.Errorf("ConvertToNetworkRuleSetPolicies() warnings = %v, want the expiration", warnings)
+		}
+
+		// The expired policy allows nothing
+		if len(rsl) == 0 {
+			t.Fatalf("ConvertToNetworkRuleSetPolicies() = no policy")
+		}
+		for _, policy := range rsl {
+			if !policy.Disabled || containsTag(policy.AssociatedTags, ReviewTag) {
+				t.Errorf("ConvertToNetworkRuleSetPolicies() = %v, want disabled without the review tag", policy)
+			}
+			if values := policy.Annotations[DisabledAnnotation]; !reflect.DeepEqual(values, []string{"false"}) {
+				t.Errorf("ConvertToNetworkRuleSetPolicies() %s annotation = %v, want [false]", DisabledAnnotation, values)
+			}
+		}
+	})
+}
+
+func TestConvertToNetworkRuleSetPoliciesDeterministic(t *testing.T) {
+
+	extnets := func() gaia.ExternalNetworksList {
+		return gaia.ExternalNetworksList{
+			{Name: "e2", AssociatedTags: []string{"zone=b", "app=ext"}, Entries: []string{"10.0.0.0/8"}, ServicePorts: []string{"udp/53", "tcp/443"}},
+			{Name: "e1", AssociatedTags: []string{"app=ext", "zone=a"}, Entries: []string{"11.0.0.0/8"}, ServicePorts: []string{"tcp/80"}},
+		}
+	}
+
+	netpol1 := gaia.NewNetworkAccessPolicy()
+	netpol1.Name = "name"
+	netpol1.Namespace = "namespace"
+	netpol1.AssociatedTags = []string{"team=b", "team=a"}
+	netpol1.Subject = [][]string{{"env=prod", "app=foo"}, {"app=bar"}}
+	netpol1.Object = [][]string{{"app=ext"}}
+	netpol1.Ports = []string{"udp/53", "tcp/80", "tcp/443"}
+	netpol1.CreateTime = time.Date(2020, time.March, 1, 10, 0, 0, 0, time.UTC)
+
+	netpol2 := netpol1.DeepCopy()
+	netpol2.AssociatedTags = []string{"team=a", "team=b"}
+	netpol2.Subject = [][]string{{"app=bar"}, {"app=foo", "env=prod"}}
+	netpol2.Ports = []string{"tcp/443", "udp/53", "tcp/80"}
+
+	opts := DefaultOptions()
+	opts.Deterministic = true
+
+	rsl1, netl1, _, err := ConvertToNetworkRuleSetPolicies(netpol1, extnets(), opts)
+	if err != nil {
+		t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+	}
+	SortNetworkRuleSetPolicies(rsl1)
+
+	en := extnets()
+	en[0], en[1] = en[1], en[0]
+	rsl2, netl2, _, err := ConvertToNetworkRuleSetPolicies(netpol2, en, opts)
+	if err != nil {
+		t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+	}
+	SortNetworkRuleSetPolicies(rsl2)
+
+	if !reflect.DeepEqual(rsl1, rsl2) {
+		t.Errorf("ConvertToNetworkRuleSetPolicies() policies differ:\n%v\n%v", rsl1, rsl2)
+	}
+	if !reflect.DeepEqual(netl1, netl2) {
+		t.Errorf("ConvertToNetworkRuleSetPolicies() external networks differ:\n%v\n%v", netl1, netl2)
+	}
+
+	for _, policy := range rsl1 {
+		if !policy.CreateTime.IsZero() {
+			t.Errorf("ConvertToNetworkRuleSetPolicies() createTime = %s, want zero", policy.CreateTime)
+		}
+		if values := policy.Annotations[CreateTimeAnnotation]; !reflect.DeepEqual(values, []string{"2020-03-01T10:00:00Z"}) {
+			t.Errorf("ConvertToNetworkRuleSetPolicies() %s annotation = %v, want the time of the policy", CreateTimeAnnotation, values)
+		}
+	}
+	names := []string{}
+	for _, extnet := range netl1 {
+		names = append(names, extnet.Name)
+	}
+	if !sort.StringsAreSorted(names) {
+		t.Errorf("ConvertToNetworkRuleSetPolicies() external networks = %v, want them sorted", names)
+	}
+}
+
+func TestConvertToNetworkRuleSetPoliciesTags(t *testing.T) {
+
+	newPolicy := func() *gaia.NetworkAccessPolicy {
+		netpol := gaia.NewNetworkAccessPolicy()
+		netpol.Name = "name"
+		netpol.Namespace = "namespace"
+		netpol.ApplyPolicyMode = gaia.NetworkAccessPolicyApplyPolicyModeOutgoingTraffic
+		netpol.Subject = [][]string{{"app=foo"}}
+		netpol.Object = [][]string{{"ext=e1"}}
+		netpol.Ports = []string{"tcp/22"}
+		return netpol
+	}
+
+	extnets := func() gaia.ExternalNetworksList {
+		return gaia.ExternalNetworksList{
+			{Name: "e1", AssociatedTags: []string{"ext=e1"}, ServicePorts: []string{"tcp/80"}},
+		}
+	}
+
+	tests := []struct {
+		name           string
+		markerTag      string
+		ineffectiveTag string
+		wantObject     [][]string
+		wantExtnetTags []string
+	}{
+		{
+			"default",
+			DefaultMarkerTag,
+			DefaultIneffectiveTag,
+			[][]string{{"ext=e1", "$identity=externalnetwork", "$name=e1", "version=v2"}, {"policy=ineffective"}},
+			[]string{"ext=e1", "version=v2"},
+		},
+		{
+			"custom",
+			"migration=v2",
+			"migration=ineffective",
+			[][]string{{"ext=e1", "$identity=externalnetwork", "$name=e1", "migration=v2"}, {"migration=ineffective"}},
+			[]string{"ext=e1", "migration=v2"},
+		},
+		{
+			"none",
+			"",
+			"",
+			[][]string{{"ext=e1", "$identity=externalnetwork", "$name=e1"}},
+			[]string{"ext=e1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			opts := DefaultOptions()
+			opts.MarkerTag = tt.markerTag
+			opts.IneffectiveTag = tt.ineffectiveTag
+
+			rsl, netl, _, err := ConvertToNetworkRuleSetPolicies(newPolicy(), extnets(), opts)
+			if err != nil {
+				t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+			}
+			if len(rsl) != 1 || len(rsl[0].OutgoingRules) != 1 {
+				t.Fatalf("ConvertToNetworkRuleSetPolicies() = %v, want one policy with one rule", rsl)
+			}
+			if got := rsl[0].OutgoingRules[0].Object; !matchObjects(tt.wantObject, got) {
+				t.Errorf("ConvertToNetworkRuleSetPolicies() object = %v, want %v", got, tt.wantObject)
+			}
+			if len(netl) != 1 || !matchTags(tt.wantExtnetTags, netl[0].AssociatedTags) {
+				t.Errorf("ConvertToNetworkRuleSetPolicies() external networks = %v, want tags %v", netl, tt.wantExtnetTags)
+			}
+		})
+	}
+}
+
+func TestConvertToNetworkRuleSetPoliciesDropIneffective(t *testing.T) {
+
+	netpol := gaia.NewNetworkAccessPolicy()
+	netpol.Name = "name"
+	netpol.Namespace = "namespace"
+	netpol.ApplyPolicyMode = gaia.NetworkAccessPolicyApplyPolicyModeOutgoingTraffic
+	netpol.Subject = [][]string{{"app=foo"}, {"app=bar"}}
+	netpol.Object = [][]string{{"ext=web"}}
+	netpol.Ports = []string{"tcp/22"}
+
+	extnets := gaia.ExternalNetworksList{
+		{Name: "e1", AssociatedTags: []string{"ext=web"}, ServicePorts: []string{"tcp/80"}},
+		{Name: "e2", AssociatedTags: []string{"ext=web"}, ServicePorts: []string{"tcp/1:1024"}},
+	}
+
+	opts := DefaultOptions()
+	opts.DropIneffective = true
+
+	rsl, netl, warnings, err := ConvertToNetworkRuleSetPolicies(netpol, extnets, opts)
+	if err != nil {
+		t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+	}
+
+	if len(rsl) != 2 {
+		t.Fatalf("ConvertToNetworkRuleSetPolicies() = %d policies, want 2", len(rsl))
+	}
+	for _, policy := range rsl {
+		if len(policy.OutgoingRules) != 1 {
+			t.Fatalf("ConvertToNetworkRuleSetPolicies() rules = %v, want 1", policy.OutgoingRules)
+		}
+		rule := policy.OutgoingRules[0]
+		if !matchObjects([][]string{{"ext=web", "$identity=externalnetwork", "$name=e2", "version=v2"}}, rule.Object) {
+			t.Errorf("ConvertToNetworkRuleSetPolicies() object = %v", rule.Object)
+		}
+		if !reflect.DeepEqual(rule.ProtocolPorts, []string{"tcp/22"}) {
+			t.Errorf("ConvertToNetworkRuleSetPolicies() ports = %v", rule.ProtocolPorts)
+		}
+	}
+
+	for _, extnet := range netl {
+		if extnet.Name != "e2" {
+			t.Errorf("ConvertToNetworkRuleSetPolicies() external network = %s, want e2 only", extnet.Name)
+		}
+	}
+
+	if len(warnings) != 2 {
+		t.Fatalf("ConvertToNetworkRuleSetPolicies() warnings = %v, want 2", warnings)
+	}
+	for _, w := range warnings {
+		if w.Code != WarningIneffectiveRuleDropped || !strings.Contains(w.Message, "tcp/22") || !strings.Contains(w.Message, "'e1'") {
+			t.Errorf("ConvertToNetworkRuleSetPolicies() warning = %s", w)
+		}
+	}
+
+	t.Run("all rules dropped", func(t *testing.T) {
+
+		rsl, netl, warnings, err := ConvertToNetworkRuleSetPolicies(netpol, extnets[:1], opts)
+		if err != nil {
+			t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+		}
+		if len(rsl) != 0 || len(netl) != 0 {
+			t.Errorf("ConvertToNetworkRuleSetPolicies() = %v, %v, want no objects", rsl, netl)
+		}
+		if len(warnings) != 2 {
+			t.Errorf("ConvertToNetworkRuleSetPolicies() warnings = %v, want 2", warnings)
+		}
+	})
+}
+
+func TestConvertToNetworkRuleSetPoliciesInvalidPorts(t *testing.T) {
+
+	netpol := gaia.NewNetworkAccessPolicy()
+	netpol.Name = "name"
+	netpol.Namespace = "namespace"
+	netpol.ApplyPolicyMode = gaia.NetworkAccessPolicyApplyPolicyModeOutgoingTraffic
+	netpol.Subject = [][]string{{"app=foo"}, {"app=bar"}}
+	netpol.Object = [][]string{{"ext=web"}}
+	netpol.Ports = []string{"tcp/80-90", "tcp/443"}
+
+	extnets := gaia.ExternalNetworksList{
+		{Name: "e1", AssociatedTags: []string{"ext=web"}, ServicePorts: []string{"tcp/443", "udp/70000"}},
+	}
+
+	rsl, _, warnings, err := ConvertToNetworkRuleSetPolicies(netpol, extnets, DefaultOptions())
+	if err != nil {
+		t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+	}
+
+	if len(rsl) != 2 {
+		t.Fatalf("ConvertToNetworkRuleSetPolicies() = %d policies, want 2", len(rsl))
+	}
+	for _, policy := range rsl {
+		if len(policy.OutgoingRules) != 1 || !reflect.DeepEqual(policy.OutgoingRules[0].ProtocolPorts, []string{"tcp/443"}) {
+			t.Errorf("ConvertToNetworkRuleSetPolicies() rules = %v, want tcp/443", policy.OutgoingRules)
+		}
+	}
+
+	// The service port is reported once even though both rules select the external network
+	if len(warnings) != 2 {
+		t.Fatalf("ConvertToNetworkRuleSetPolicies() warnings = %v, want 2", warnings)
+	}
+	for i, want := range []string{"'tcp/80-90'", "'udp/70000'"} {
+		if warnings[i].Code != WarningInvalidPort || !strings.Contains(warnings[i].Message, want) {
+			t.Errorf("ConvertToNetworkRuleSetPolicies() warning = %s, want %s", warnings[i], want)
+		}
+	}
+	if !strings.Contains(warnings[1].Message, "'e1'") {
+		t.Errorf("ConvertToNetworkRuleSetPolicies() warning = %s, want external network", warnings[1])
+	}
+
+	t.Run("no external network", func(t *testing.T) {
+
+		np := netpol.DeepCopy()
+		np.Ports = []string{"udp/1:2:3", "tcp/443"}
+
+		rsl, _, warnings, err := ConvertToNetworkRuleSetPolicies(np, extnets[:0], DefaultOptions())
+		if err != nil {
+			t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+		}
+		for _, policy := range rsl {
+			if len(policy.OutgoingRules) != 1 || !reflect.DeepEqual(policy.OutgoingRules[0].ProtocolPorts, []string{"tcp/443"}) {
+				t.Errorf("ConvertToNetworkRuleSetPolicies() rules = %v, want tcp/443", policy.OutgoingRules)
+			}
+			if policy.Disabled {
+				t.Errorf("ConvertToNetworkRuleSetPolicies() disabled = true, want false")
+			}
+		}
+		if len(warnings) != 1 || !strings.Contains(warnings[0].Message, "'udp/1:2:3'") {
+			t.Errorf("ConvertToNetworkRuleSetPolicies() warnings = %v, want udp/1:2:3", warnings)
+		}
+	})
+
+	t.Run("no valid port", func(t *testing.T) {
+
+		np := netpol.DeepCopy()
+		np.Ports = []string{"udp/1:2:3"}
+
+		rsl, _, warnings, err := ConvertToNetworkRuleSetPolicies(np, extnets[:0], DefaultOptions())
+		if err != nil {
+			t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+		}
+		for _, policy := range rsl {
+			if len(policy.OutgoingRules[0].ProtocolPorts) != 0 {
+				t.Errorf("ConvertToNetworkRuleSetPolicies() ports = %v, want none", policy.OutgoingRules[0].ProtocolPorts)
+			}
+			if !policy.Disabled || !reflect.DeepEqual(policy.Annotations[DisabledAnnotation], []string{"false"}) {
+				t.Errorf("ConvertToNetworkRuleSetPolicies() disabled = %v, annotations = %v, want disabled", policy.Disabled, policy.Annotations)
+			}
+		}
+		if len(warnings) != 2 || !strings.Contains(warnings[1].Message, "no valid port") {
+			t.Errorf("ConvertToNetworkRuleSetPolicies() warnings = %v, want no valid port", warnings)
+		}
+	})
+
+	t.Run("strict", func(t *testing.T) {
+
+		opts := DefaultOptions()
+		opts.Strict = true
+
+		_, _, _, err := ConvertToNetworkRuleSetPolicies(netpol, extnets, opts)
+		if !errors.Is(err, ErrInvalidPort) {
+			t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v, want %v", err, ErrInvalidPort)
+		}
+
+		var perr *PolicyError
+		if !errors.As(err, &perr) || perr.Name != "name" {
+			t.Errorf("ConvertToNetworkRuleSetPolicies() error = %v, want a PolicyError", err)
+		}
+
+		if !strings.Contains(err.Error(), "tcp/80-90") || !strings.Contains(err.Error(), "udp/70000") {
+			t.Errorf("ConvertToNetworkRuleSetPolicies() error = %v, want every invalid port", err)
+		}
+	})
+
+	t.Run("strict with valid ports", func(t *testing.T) {
+
+		opts := DefaultOptions()
+		opts.Strict = true
+
+		valid := netpol.DeepCopy()
+		valid.Ports = []string{"tcp/443"}
+
+		if _, _, _, err := ConvertToNetworkRuleSetPolicies(valid, extnets[:0], opts); err != nil {
+			t.Errorf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+		}
+	})
+}
+
+func TestConvertToNetworkRuleSetPoliciesLogger(t *testing.T) {
+
+	netpol := gaia.NewNetworkAccessPolicy()
+	netpol.Name = "name"
+	netpol.Namespace = "namespace"
+	netpol.ApplyPolicyMode = gaia.NetworkAccessPolicyApplyPolicyModeOutgoingTraffic
+	netpol.Subject = [][]string{{"app=foo"}}
+	netpol.Object = [][]string{{"ext=web"}}
+	netpol.Ports = []string{"tcp/22"}
+
+	extnets := gaia.ExternalNetworksList{
+		{Name: "e1", AssociatedTags: []string{"ext=web"}, ServicePorts: []string{"tcp/80"}},
+		{Name: "e2", AssociatedTags: []string{"ext=web"}, ServicePorts: []string{"tcp/1:1024"}},
+	}
+
+	core, logs := observer.New(zap.DebugLevel)
+
+	opts := DefaultOptions()
+	opts.DropIneffective = true
+	opts.Logger = zap.New(core)
+
+	if _, _, _, err := ConvertToNetworkRuleSetPolicies(netpol, extnets, opts); err != nil {
+		t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+	}
+
+	for _, msg := range []string{
+		"converting network access policy",
+		"rule matches external networks",
+		"intersected ports with service ports",
+		"rule dropped as ineffective",
+		"converted network access policy",
+	} {
+		entries := logs.FilterMessage(msg).All()
+		if len(entries) == 0 {
+			t.Errorf("ConvertToNetworkRuleSetPolicies() no log %q", msg)
+			continue
+		}
+		if entries[0].Level != zap.DebugLevel || entries[0].ContextMap()["policy"] != "name" {
+			t.Errorf("ConvertToNetworkRuleSetPolicies() log %q = %v %v, want debug with the policy name", msg, entries[0].Level, entries[0].ContextMap())
+		}
+	}
+
+	if n := logs.FilterMessage("intersected ports with service ports").Len(); n != 2 {
+		t.Errorf("ConvertToNetworkRuleSetPolicies() intersections logged = %d, want 2", n)
+	}
+}
+
+func TestConvertToNetworkRuleSetPoliciesNamespaces(t *testing.T) {
+
+	// External networks of a multi-namespace export
+	extnets := gaia.ExternalNetworksList{
+		{Name: "internet", Namespace: "/corp", Propagate: true, AssociatedTags: []string{"ext=internet"}},
+		{Name: "internet", Namespace: "/corp/dmz", Propagate: true, AssociatedTags: []string{"ext=internet"}, ServicePorts: []string{"tcp/443"}},
+		{Name: "private", Namespace: "/corp", AssociatedTags: []string{"ext=private"}},
+		{Name: "sibling", Namespace: "/corp/lab", Propagate: true, AssociatedTags: []string{"ext=sibling"}},
+		{Name: "local", Namespace: "/corp/dmz/tenant-x", AssociatedTags: []string{"ext=local"}},
+	}
+
+	newPolicy := func(objects ...[]string) *gaia.NetworkAccessPolicy {
+		netpol := gaia.NewNetworkAccessPolicy()
+		netpol.Name = "name"
+		netpol.Namespace = "/corp/dmz/tenant-x"
+		netpol.ApplyPolicyMode = gaia.NetworkAccessPolicyApplyPolicyModeOutgoingTraffic
+		netpol.Subject = [][]string{{"app=foo"}}
+		netpol.Object = objects
+		netpol.Ports = []string{"tcp/443"}
+		return netpol
+	}
+
+	tests := []struct {
+		name        string
+		netpol      *gaia.NetworkAccessPolicy
+		wantObjects [][][]string
+		wantExtnets []string
+	}{
+		{
+			name:   "propagated from parents",
+			netpol: newPolicy([]string{"ext=internet"}),
+			wantObjects: [][][]string{
+				{{"ext=internet", "$identity=externalnetwork", "$name=internet", "$namespace=/corp", "version=v2"}},
+				{{"ext=internet", "$identity=externalnetwork", "$name=internet", "$namespace=/corp/dmz", "version=v2"}},
+			},
+			wantExtnets: []string{"/corp/internet", "/corp/dmz/internet"},
+		},
+		{
+			name:   "namespace selector",
+			netpol: newPolicy([]string{"ext=internet", "$namespace=/corp/dmz"}),
+			wantObjects: [][][]string{
+				{{"ext=internet", "$namespace=/corp/dmz", "$identity=externalnetwork", "$name=internet", "version=v2"}},
+			},
+			wantExtnets: []string{"/corp/dmz/internet"},
+		},
+		{
+			name:   "same namespace",
+			netpol: newPolicy([]string{"ext=local"}),
+			wantObjects: [][][]string{
+				{{"ext=local", "$identity=externalnetwork", "$name=local", "$namespace=/corp/dmz/tenant-x", "version=v2"}},
+			},
+			wantExtnets: []string{"/corp/dmz/tenant-x/local"},
+		},
+		{
+			name:        "not propagated",
+			netpol:      newPolicy([]string{"ext=private"}),
+			wantObjects: [][][]string{{{"ext=private"}}},
+		},
+		{
+			name:        "sibling",
+			netpol:      newPolicy([]string{"ext=sibling"}),
+			wantObjects: [][][]string{{{"ext=sibling"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			rsl, netl, _, err := ConvertToNetworkRuleSetPolicies(tt.netpol, extnets, DefaultOptions())
+			if err != nil {
+				t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+			}
+
+			if len(rsl) != 1 || len(rsl[0].OutgoingRules) != len(tt.wantObjects) {
+				t.Fatalf("ConvertToNetworkRuleSetPolicies() = %v, want one policy with %d rules", rsl, len(tt.wantObjects))
+			}
+			for i, rule := range rsl[0].OutgoingRules {
+				if !matchObjects(tt.wantObjects[i], rule.Object) {
+					t.Errorf("ConvertToNetworkRuleSetPolicies() object = %v, want %v", rule.Object, tt.wantObjects[i])
+				}
+			}
+
+			got := []string{}
+			for _, extnet := range netl {
+				got = append(got, extnet.Namespace+"/"+extnet.Name)
+			}
+			if len(got) != len(tt.wantExtnets) || (len(got) != 0 && !reflect.DeepEqual(got, tt.wantExtnets)) {
+				t.Errorf("ConvertToNetworkRuleSetPolicies() external networks = %v, want %v", got, tt.wantExtnets)
+			}
+		})
+	}
+
+	t.Run("duplicate in the same namespace", func(t *testing.T) {
+
+		dup := append(gaia.ExternalNetworksList{{Name: "internet", Namespace: "/corp", AssociatedTags: []string{"ext=internet"}}}, extnets...)
+		err := CheckDuplicateExternalNetworks(newPolicy([]string{"ext=internet"}), DuplicateExternalNetworks(dup))
+		if !errors.Is(err, ErrDuplicateName) {
+			t.Errorf("CheckDuplicateExternalNetworks() error = %v, want %v", err, ErrDuplicateName)
+		}
+	})
+}
+
+func TestConvertToNetworkRuleSetPoliciesSelectors(t *testing.T) {
+
+	extnets := gaia.ExternalNetworksList{
+		{ID: "1", Name: "e1", AssociatedTags: []string{"ext=web"}},
+		{ID: "2", Name: "e2", AssociatedTags: []string{"ext=web"}},
+	}
+
+	netpol := gaia.NewNetworkAccessPolicy()
+	netpol.Name = "name"
+	netpol.ApplyPolicyMode = gaia.NetworkAccessPolicyApplyPolicyModeOutgoingTraffic
+	netpol.Subject = [][]string{{"app=foo"}}
+	netpol.Object = [][]string{{"$identity=externalnetwork", "$id=2"}, {"$identity=externalnetwork", "$name=e1"}}
+
+	rsl, netl, _, err := ConvertToNetworkRuleSetPolicies(netpol, extnets, DefaultOptions())
+	if err != nil {
+		t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+	}
+
+	if len(rsl) != 1 || len(rsl[0].OutgoingRules) != 2 || len(netl) != 2 {
+		t.Fatalf("ConvertToNetworkRuleSetPolicies() = %v, %v, want one policy with 2 rules", rsl, netl)
+	}
+
+	// The v2 copy gets a new ID, the rules select it by name
+	want := [][][]string{
+		{{"$identity=externalnetwork", "$name=e2", "version=v2"}},
+		{{"$identity=externalnetwork", "$name=e1", "version=v2"}},
+	}
+	for i, rule := range rsl[0].OutgoingRules {
+		if !matchObjects(want[i], rule.Object) || len(rule.Object[0]) != len(want[i][0]) {
+			t.Errorf("ConvertToNetworkRuleSetPolicies() object = %v, want %v", rule.Object, want[i])
+		}
+	}
+}
+
+func TestConvertToNetworkRuleSetPoliciesProcessingUnitSelectors(t *testing.T) {
+
+	extnets := gaia.ExternalNetworksList{
+		{Name: "e1", AssociatedTags: []string{"ext=web"}},
+	}
+
+	for _, clause := range [][]string{
+		{"$image=nginx"},
+		{"$hostname=h", "$identity=processingunit"},
+	} {
+		t.Run(strings.Join(clause, " "), func(t *testing.T) {
+
+			netpol := gaia.NewNetworkAccessPolicy()
+			netpol.Name = "name"
+			netpol.ApplyPolicyMode = gaia.NetworkAccessPolicyApplyPolicyModeBidirectional
+			netpol.Subject = [][]string{clause}
+			netpol.Object = [][]string{clause}
+
+			rsl, netl, _, err := ConvertToNetworkRuleSetPolicies(netpol, extnets, DefaultOptions())
+			if err != nil {
+				t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+			}
+
+			if len(rsl) != 2 || len(netl) != 0 {
+				t.Fatalf("ConvertToNetworkRuleSetPolicies() = %v, %v, want 2 policies and no external network", rsl, netl)
+			}
+
+			for _, policy := range rsl {
+				for _, rule := range append(policy.IncomingRules, policy.OutgoingRules...) {
+					if !reflect.DeepEqual(rule.Object, [][]string{clause}) {
+						t.Errorf("ConvertToNetworkRuleSetPolicies() object = %v, want %v", rule.Object, clause)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestExternalNetworkVisible(t *testing.T) {
+
+	tests := []struct {
+		name      string
+		extnet    *gaia.ExternalNetwork
+		namespace string
+		want      bool
+	}{
+		{"no namespace", &gaia.ExternalNetwork{}, "/a", true},
+		{"no policy namespace", &gaia.ExternalNetwork{Namespace: "/a"}, "", true},
+		{"same namespace", &gaia.ExternalNetwork{Namespace: "/a/b"}, "/a/b", true},
+		{"child not propagated", &gaia.ExternalNetwork{Namespace: "/a"}, "/a/b", false},
+		{"child propagated", &gaia.ExternalNetwork{Namespace: "/a", Propagate: true}, "/a/b/c", true},
+		{"root propagated", &gaia.ExternalNetwork{Namespace: "/", Propagate: true}, "/a", true},
+		{"parent", &gaia.ExternalNetwork{Namespace: "/a/b", Propagate: true}, "/a", false},
+		{"sibling", &gaia.ExternalNetwork{Namespace: "/a/b", Propagate: true}, "/a/c", false},
+		{"name prefix", &gaia.ExternalNetwork{Namespace: "/a/b", Propagate: true}, "/a/bc", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExternalNetworkVisible(tt.extnet, tt.namespace); got != tt.want {
+				t.Errorf("ExternalNetworkVisible() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func matchTags(want, got []string) bool {
 
 	if len(want) != len(got) {
@@ -0,0 +1,64 @@
+package rulesetpolicies
+
+import (
+	"fmt"
+
+	"go.aporeto.io/gaia"
+)
+
+// WarningCode identifies the kind of a warning.
+type WarningCode string
+
+// Warning codes.
+const (
+	// WarningContinueAction is reported for the policies with the Continue action.
+	WarningContinueAction WarningCode = "ContinueAction"
+
+	// WarningObservedTrafficApplied is reported for the observed policies applying
+	// their action, which are converted to enforced rules without observation.
+	WarningObservedTrafficApplied WarningCode = "ObservedTrafficApplied"
+
+	// WarningUnknownObservedTrafficAction is reported for the observed policies with
+	// an unknown observed traffic action, which are converted to observed rules.
+	WarningUnknownObservedTrafficAction WarningCode = "UnknownObservedTrafficAction"
+
+	// WarningActivationSchedule is reported for the policies only active on a schedule.
+	WarningActivationSchedule WarningCode = "ActivationSchedule"
+
+	// WarningExpirationTime is reported for the policies with an expiration time.
+	WarningExpirationTime WarningCode = "ExpirationTime"
+
+	// WarningIneffectiveRuleDropped is reported for each rule dropped because
+	// it matches no traffic, see Options.DropIneffective.
+	WarningIneffectiveRuleDropped WarningCode = "IneffectiveRuleDropped"
+
+	// WarningInvalidPort is reported for each port of the policy and each service port of
+	// the external networks it selects that cannot be parsed, see Options.Strict, and for
+	// the policies left without a valid port, which are generated disabled.
+	WarningInvalidPort WarningCode = "InvalidPort"
+)
+
+// Warning reports a network access policy that was converted, but whose
+// conversion does not fully preserve its behavior or needs to be reviewed.
+type Warning struct {
+	ID        string
+	Name      string
+	Namespace string
+	Code      WarningCode
+	Message   string
+}
+
+// newWarning returns a new Warning for the given policy.
+func newWarning(netpol *gaia.NetworkAccessPolicy, code WarningCode, format string, args ...interface{}) *Warning {
+	return &Warning{
+		ID:        netpol.ID,
+		Name:      netpol.Name,
+		Namespace: netpol.Namespace,
+		Code:      code,
+		Message:   fmt.Sprintf(format, args...),
+	}
+}
+
+func (w *Warning) String() string {
+	return fmt.Sprintf("%s (namespace: '%s'): %s: %s", w.Name, w.Namespace, w.Code, w.Message)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/satyamsi/migrate/rulesetpolicies"
+	"github.com/satyamsi/migrate/verify"
+)
+
+// tagList is a flag that can be repeated to give several tags.
+type tagList []string
+
+func (l *tagList) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *tagList) Set(value string) error {
+	*l = append(*l, value)
+	return nil
+}
+
+func runSimulate(args []string) error {
+
+	var from, to tagList
+
+	fs := flag.NewFlagSet("simulate", flag.ExitOnError)
+	in := fs.String("in", "", "export file holding the network access policies, or '-' to read from stdin")
+	converted := fs.String("converted", "", "export file produced by the convert command")
+	ineffectiveTag := fs.String("ineffective-tag", rulesetpolicies.DefaultIneffectiveTag, "tag the convert command used to mark the rules that match no traffic")
+	fs.Var(&from, "from", "tag of the source, can be repeated")
+	fs.Var(&to, "to", "tag of the destination, can be repeated")
+	port := fs.String("port", "", "protocol and port of the traffic, like tcp/443 or icmp")
+	logs := addLogFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	logger, err := logs.newLogger()
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case *in == "":
+		return fmt.Errorf("missing --in")
+	case *converted == "":
+		return fmt.Errorf("missing --converted")
+	case *in == stdio && *converted == stdio:
+		return fmt.Errorf("--in and --converted cannot both read from stdin")
+	case len(from) == 0:
+		return fmt.Errorf("missing --from")
+	case len(to) == 0:
+		return fmt.Errorf("missing --to")
+	case *port == "":
+		return fmt.Errorf("missing --port")
+	}
+
+	protocol, portNumber, err := verify.ParseProtocolPort(*port)
+	if err != nil {
+		return err
+	}
+
+	bundle, err := readInput(*in, logger)
+	if err != nil {
+		return err
+	}
+
+	convertedBundle, err := readInput(*converted, logger)
+	if err != nil {
+		return err
+	}
+
+	input := &verify.Input{
+		NetworkAccessPolicies:     bundle.NetworkAccessPolicies(),
+		ExternalNetworks:          bundle.ExternalNetworks(),
+		NetworkRuleSetPolicies:    convertedBundle.NetworkRuleSetPolicies(),
+		ConvertedExternalNetworks: convertedBundle.ExternalNetworks(),
+		IneffectiveTag:            *ineffectiveTag,
+	}
+
+	simulation, err := verify.Simulate(input, &verify.Query{
+		Source:      from,
+		Destination: to,
+		Protocol:    protocol,
+		Port:        portNumber,
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stdout, "Flow: %s\n", simulation.Flow)
+	printEvaluation(os.Stdout, "Network access policies (v1)", simulation.V1)
+	printEvaluation(os.Stdout, "Network rule set policies (v2)", simulation.V2)
+
+	return nil
+}
+
+func printEvaluation(w io.Writer, title string, e *verify.Evaluation) {
+
+	fmt.Fprintf(w, "\n%s: %s\n", title, e.Verdict)
+
+	if len(e.Matches) == 0 {
+		fmt.Fprintf(w, "  no matching policy\n")
+		return
+	}
+
+	for _, m := range e.Matches {
+		fmt.Fprintf(w, "  - %s\n", m)
+	}
+}
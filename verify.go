@@ -0,0 +1,80 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/satyamsi/migrate/rulesetpolicies"
+	"github.com/satyamsi/migrate/verify"
+)
+
+func runVerify(args []string) error {
+
+	fs := flag.NewFlagSet("verify", flag.ExitOnError)
+	in := fs.String("in", "", "export file holding the network access policies, or '-' to read from stdin")
+	converted := fs.String("converted", "", "export file produced by the convert command")
+	ineffectiveTag := fs.String("ineffective-tag", rulesetpolicies.DefaultIneffectiveTag, "tag the convert command used to mark the rules that match no traffic")
+	maxFlows := fs.Int("max-flows", 1000000, "maximum number of flows to evaluate, an evenly spread sample of them is evaluated beyond it (0 evaluates them all)")
+	logs := addLogFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	logger, err := logs.newLogger()
+	if err != nil {
+		return err
+	}
+
+	if *in == "" {
+		return fmt.Errorf("missing --in")
+	}
+
+	if *converted == "" {
+		return fmt.Errorf("missing --converted")
+	}
+
+	if *maxFlows < 0 {
+		return fmt.Errorf("invalid --max-flows %d: must be positive or 0", *maxFlows)
+	}
+
+	if *in == stdio && *converted == stdio {
+		return fmt.Errorf("--in and --converted cannot both read from stdin")
+	}
+
+	bundle, err := readInput(*in, logger)
+	if err != nil {
+		return err
+	}
+
+	convertedBundle, err := readInput(*converted, logger)
+	if err != nil {
+		return err
+	}
+
+	result := verify.Verify(&verify.Input{
+		NetworkAccessPolicies:     bundle.NetworkAccessPolicies(),
+		ExternalNetworks:          bundle.ExternalNetworks(),
+		NetworkRuleSetPolicies:    convertedBundle.NetworkRuleSetPolicies(),
+		ConvertedExternalNetworks: convertedBundle.ExternalNetworks(),
+		IneffectiveTag:            *ineffectiveTag,
+		MaxFlows:                  *maxFlows,
+	})
+
+	fmt.Fprintf(os.Stdout, "Verified %d flows\n", result.Flows)
+
+	if result.Skipped != 0 {
+		fmt.Fprintf(os.Stderr, "Warning: %d of %d flows skipped by --max-flows, raise it to verify every flow\n", result.Skipped, result.Flows+result.Skipped)
+	}
+
+	if result.Equivalent() {
+		return nil
+	}
+
+	fmt.Fprintf(os.Stdout, "Flows with a different verdict:\n")
+	for _, m := range result.Mismatches {
+		fmt.Fprintf(os.Stdout, "  - %s\n", m)
+	}
+
+	return fmt.Errorf("%d flows do not get the same verdict once converted", len(result.Mismatches))
+}
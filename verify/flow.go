@@ -0,0 +1,168 @@
+package verify
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/satyamsi/migrate/rulesetpolicies"
+	"go.aporeto.io/gaia"
+)
+
+const (
+	identityExternalNetwork = "$identity=externalnetwork"
+	identityProcessingUnit  = "$identity=processingunit"
+	namespacePrefix         = "$namespace="
+	namePrefix              = "$name="
+)
+
+// Endpoint is one end of a flow.
+type Endpoint struct {
+	// Name describes the endpoint in reports.
+	Name string
+
+	// Tags are the tags of the endpoint. For an external network they are the
+	// tags of the network given to the access policies.
+	Tags []string
+
+	// V2Tags are the tags of an external network once converted. They are the
+	// same as Tags for processing units.
+	V2Tags []string
+
+	// ExternalNetwork is the external network the endpoint belongs to, if any.
+	ExternalNetwork *gaia.ExternalNetwork
+}
+
+// NewProcessingUnitEndpoint returns an endpoint for a processing unit with the given tags.
+func NewProcessingUnitEndpoint(tags []string) *Endpoint {
+
+	tags = appendMissing(append([]string{}, tags...), identityProcessingUnit)
+
+	return &Endpoint{
+		Name:   strings.Join(tags, " "),
+		Tags:   tags,
+		V2Tags: tags,
+	}
+}
+
+// NewExternalNetworkEndpoint returns an endpoint for an address of the given
+// external network. The converted copies of the network, if any, provide the
+// tags of the endpoint in the v2 model.
+func NewExternalNetworkEndpoint(extnet *gaia.ExternalNetwork, converted gaia.ExternalNetworksList) *Endpoint {
+
+	tags := externalNetworkTags(extnet)
+
+	v2Tags := []string{}
+	for _, c := range converted {
+		if c.Name == extnet.Name && c.Namespace == extnet.Namespace {
+			v2Tags = appendMissing(v2Tags, externalNetworkTags(c)...)
+		}
+	}
+	if len(v2Tags) == 0 {
+		v2Tags = tags
+	}
+
+	name := "externalnetwork " + extnet.Name
+	if extnet.Namespace != "" {
+		name += " (namespace: '" + extnet.Namespace + "')"
+	}
+
+	return &Endpoint{
+		Name:            name,
+		Tags:            tags,
+		V2Tags:          v2Tags,
+		ExternalNetwork: extnet,
+	}
+}
+
+// IsExternalNetwork returns true if the endpoint is an external network.
+func (e *Endpoint) IsExternalNetwork() bool {
+	return e.ExternalNetwork != nil
+}
+
+// matches returns true if one of the 'OR' clauses of a policy of the given namespace
+// matches the tags of the endpoint in the given model.
+func (e *Endpoint) matches(clauses [][]string, namespace string, v2 bool) bool {
+
+	// Like on the platform, a policy only selects the external networks visible in its namespace
+	if e.IsExternalNetwork() && !rulesetpolicies.ExternalNetworkVisible(e.ExternalNetwork, namespace) {
+		return false
+	}
+
+	tags := e.Tags
+	if v2 {
+		tags = e.V2Tags
+	}
+
+	for _, clause := range clauses {
+		if e.matchesClause(clause, tags) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e *Endpoint) matchesClause(clause []string, tags []string) bool {
+
+	if len(clause) == 0 {
+		return false
+	}
+
+	for _, tag := range clause {
+
+		// Like the converter, namespaces are not taken into account for external networks without one
+		if e.IsExternalNetwork() && e.ExternalNetwork.Namespace == "" && strings.HasPrefix(tag, namespacePrefix) {
+			continue
+		}
+
+		if !contains(tags, tag) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Flow is a connection from a source to a destination on a protocol and port.
+type Flow struct {
+	Source      *Endpoint
+	Destination *Endpoint
+	Protocol    string
+	Port        int
+}
+
+func (f *Flow) String() string {
+
+	if f.Port == 0 {
+		return fmt.Sprintf("%s -> %s %s", f.Source.Name, f.Destination.Name, f.Protocol)
+	}
+
+	return fmt.Sprintf("%s -> %s %s/%d", f.Source.Name, f.Destination.Name, f.Protocol, f.Port)
+}
+
+// externalNetworkTags returns the tags an external network can be selected with.
+func externalNetworkTags(extnet *gaia.ExternalNetwork) []string {
+	return appendMissing(append([]string{}, extnet.AssociatedTags...), rulesetpolicies.ExternalNetworkMetadataTags(extnet)...)
+}
+
+func contains(tags []string, tag string) bool {
+
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+
+	return false
+}
+
+func appendMissing(tags []string, others ...string) []string {
+
+	for _, o := range others {
+		if !contains(tags, o) {
+			tags = append(tags, o)
+		}
+	}
+
+	return tags
+}
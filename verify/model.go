@@ -0,0 +1,281 @@
+package verify
+
+import (
+	"fmt"
+
+	"go.aporeto.io/gaia"
+)
+
+// Verdict is the decision taken for a flow.
+type Verdict string
+
+// Possible verdicts.
+const (
+	VerdictAllow  Verdict = "Allow"
+	VerdictReject Verdict = "Reject"
+)
+
+// Direction is the side of a flow a policy is enforced on.
+type Direction string
+
+// Possible directions.
+const (
+	DirectionOutgoing Direction = "outgoing"
+	DirectionIncoming Direction = "incoming"
+)
+
+// Match is a policy, or a rule of a policy, matching a flow.
+type Match struct {
+	// Policy is the name of the policy.
+	Policy string
+
+	// Namespace is the namespace of the policy.
+	Namespace string
+
+	// Direction is the side of the flow the policy applies to.
+	Direction Direction
+
+	// Rule is the index of the matching rule in the incoming or outgoing
+	// rules of a network rule set policy, -1 for a network access policy.
+	Rule int
+
+	// Action is the action of the policy or rule.
+	Action Verdict
+
+	// Fallback is true if the policy is a fallback policy.
+	Fallback bool
+
+	// Observed is true if the policy or rule only observes the traffic,
+	// which is then decided by the other policies.
+	Observed bool
+}
+
+func (m *Match) String() string {
+
+	s := fmt.Sprintf("%s (namespace: '%s') %s", m.Policy, m.Namespace, m.Direction)
+	if m.Rule >= 0 {
+		s += fmt.Sprintf(" rule %d", m.Rule)
+	}
+	s += " " + string(m.Action)
+
+	if m.Fallback {
+		s += " (fallback)"
+	}
+
+	if m.Observed {
+		s += " (observed)"
+	}
+
+	return s
+}
+
+// Evaluation is the result of the evaluation of a flow in a model.
+type Evaluation struct {
+	// Verdict is the final decision for the flow.
+	Verdict Verdict
+
+	// Matches are the policies and rules that matched the flow.
+	Matches []*Match
+}
+
+// decision accumulates the actions of the policies matching one side of a flow.
+// Reject wins over allow, and fallback policies are only considered when no
+// other policy matched. Without any match the flow is rejected.
+type decision struct {
+	allow          bool
+	reject         bool
+	fallbackAllow  bool
+	fallbackReject bool
+}
+
+func (d *decision) add(m *Match) {
+
+	allow := m.Action == VerdictAllow
+
+	switch {
+	case m.Fallback && allow:
+		d.fallbackAllow = true
+	case m.Fallback:
+		d.fallbackReject = true
+	case allow:
+		d.allow = true
+	default:
+		d.reject = true
+	}
+}
+
+func (d *decision) verdict() Verdict {
+
+	switch {
+	case d.reject:
+		return VerdictReject
+	case d.allow:
+		return VerdictAllow
+	case d.fallbackReject:
+		return VerdictReject
+	case d.fallbackAllow:
+		return VerdictAllow
+	default:
+		return VerdictReject
+	}
+}
+
+// evaluation accumulates the matches of both sides of a flow.
+type evaluation struct {
+	outgoing decision
+	incoming decision
+	matches  []*Match
+}
+
+func (e *evaluation) add(m *Match) {
+
+	e.matches = append(e.matches, m)
+
+	if m.Observed {
+		return
+	}
+
+	if m.Direction == DirectionOutgoing {
+		e.outgoing.add(m)
+	} else {
+		e.incoming.add(m)
+	}
+}
+
+// result returns the verdict of a flow from the verdicts of its source and destination.
+// External networks have no enforcer, so only the side of the processing unit counts.
+func (e *evaluation) result(f *Flow) *Evaluation {
+
+	out := &Evaluation{
+		Verdict: VerdictAllow,
+		Matches: e.matches,
+	}
+
+	if !f.Source.IsExternalNetwork() && e.outgoing.verdict() == VerdictReject {
+		out.Verdict = VerdictReject
+	}
+
+	if !f.Destination.IsExternalNetwork() && e.incoming.verdict() == VerdictReject {
+		out.Verdict = VerdictReject
+	}
+
+	return out
+}
+
+// EvaluateV1 evaluates the flow against the network access policies.
+func EvaluateV1(f *Flow, policies gaia.NetworkAccessPoliciesList) *Evaluation {
+
+	e := &evaluation{matches: []*Match{}}
+
+	for _, p := range policies {
+
+		if p.Disabled || p.Action == gaia.NetworkAccessPolicyActionContinue {
+			continue
+		}
+
+		if !f.Source.matches(p.Subject, p.Namespace, false) || !f.Destination.matches(p.Object, p.Namespace, false) {
+			continue
+		}
+
+		if !portsMatch(p.Ports, f.Protocol, f.Port) {
+			continue
+		}
+
+		// Traffic with an external network is limited to its service ports
+		if !externalNetworkPortsMatch(f) {
+			continue
+		}
+
+		action := VerdictReject
+		if p.Action == gaia.NetworkAccessPolicyActionAllow {
+			action = VerdictAllow
+		}
+
+		observed := p.ObservationEnabled && p.ObservedTrafficAction != gaia.NetworkAccessPolicyObservedTrafficActionApply
+
+		if p.ApplyPolicyMode == gaia.NetworkAccessPolicyApplyPolicyModeOutgoingTraffic ||
+			p.ApplyPolicyMode == gaia.NetworkAccessPolicyApplyPolicyModeBidirectional {
+			e.add(&Match{Policy: p.Name, Namespace: p.Namespace, Direction: DirectionOutgoing, Rule: -1, Action: action, Fallback: p.Fallback, Observed: observed})
+		}
+
+		if p.ApplyPolicyMode == gaia.NetworkAccessPolicyApplyPolicyModeIncomingTraffic ||
+			p.ApplyPolicyMode == gaia.NetworkAccessPolicyApplyPolicyModeBidirectional {
+			e.add(&Match{Policy: p.Name, Namespace: p.Namespace, Direction: DirectionIncoming, Rule: -1, Action: action, Fallback: p.Fallback, Observed: observed})
+		}
+	}
+
+	return e.result(f)
+}
+
+// EvaluateV2 evaluates the flow against the network rule set policies.
+// The rules holding an object clause made of the ineffective tag alone are
+// the rules the conversion marked as matching no traffic, they are ignored.
+func EvaluateV2(f *Flow, policies gaia.NetworkRuleSetPoliciesList, ineffectiveTag string) *Evaluation {
+
+	e := &evaluation{matches: []*Match{}}
+
+	addRules := func(p *gaia.NetworkRuleSetPolicy, direction Direction, rules []*gaia.NetworkRule, peer *Endpoint) {
+		for i, rule := range rules {
+
+			if isIneffective(rule, ineffectiveTag) {
+				continue
+			}
+
+			if !peer.matches(rule.Object, p.Namespace, true) || !portsMatch(rule.ProtocolPorts, f.Protocol, f.Port) {
+				continue
+			}
+
+			action := VerdictReject
+			if rule.Action == gaia.NetworkRuleActionAllow {
+				action = VerdictAllow
+			}
+
+			e.add(&Match{Policy: p.Name, Namespace: p.Namespace, Direction: direction, Rule: i, Action: action, Fallback: p.Fallback, Observed: rule.ObservationEnabled})
+		}
+	}
+
+	for _, p := range policies {
+
+		if p.Disabled {
+			continue
+		}
+
+		if f.Source.matches(p.Subject, p.Namespace, true) {
+			addRules(p, DirectionOutgoing, p.OutgoingRules, f.Destination)
+		}
+
+		if f.Destination.matches(p.Subject, p.Namespace, true) {
+			addRules(p, DirectionIncoming, p.IncomingRules, f.Source)
+		}
+	}
+
+	return e.result(f)
+}
+
+// externalNetworkPortsMatch returns true if the flow uses a service port of the external networks it involves.
+func externalNetworkPortsMatch(f *Flow) bool {
+
+	for _, e := range []*Endpoint{f.Source, f.Destination} {
+		if e.IsExternalNetwork() && !portsMatch(e.ExternalNetwork.ServicePorts, f.Protocol, f.Port) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// isIneffective returns true if the rule is marked with the ineffective tag.
+func isIneffective(rule *gaia.NetworkRule, ineffectiveTag string) bool {
+
+	if ineffectiveTag == "" {
+		return false
+	}
+
+	for _, clause := range rule.Object {
+		if len(clause) == 1 && clause[0] == ineffectiveTag {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,143 @@
+package verify
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/satyamsi/migrate/intersection"
+)
+
+const (
+	protocolTCP = "tcp"
+	protocolUDP = "udp"
+	protocolAny = "any"
+
+	maxPort = 65535
+)
+
+// portsMatch returns true if the protocol and port are part of the given
+// protocols and ports. An empty list matches everything.
+func portsMatch(protocolPorts []string, protocol string, port int) bool {
+
+	if len(protocolPorts) == 0 {
+		return true
+	}
+
+	for _, entry := range protocolPorts {
+
+		parts := strings.SplitN(strings.ToLower(entry), "/", 2)
+
+		if parts[0] == protocolAny {
+			return true
+		}
+
+		if parts[0] != protocol {
+			continue
+		}
+
+		// Protocols without ports, or ICMP types and codes, match on the protocol alone
+		if protocol != protocolTCP && protocol != protocolUDP {
+			return true
+		}
+
+		if len(parts) < 2 {
+			continue
+		}
+
+		spec, err := intersection.NewPortSpecFromString(parts[1], nil)
+		if err != nil {
+			continue
+		}
+
+		if port >= int(spec.Min) && port <= int(spec.Max) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sampler collects the protocols and ports worth testing from lists of protocols and ports.
+type sampler struct {
+	ports     map[string]map[int]struct{}
+	protocols map[string]struct{}
+}
+
+func newSampler() *sampler {
+	return &sampler{
+		ports: map[string]map[int]struct{}{
+			protocolTCP: {1: {}},
+			protocolUDP: {1: {}},
+		},
+		protocols: map[string]struct{}{},
+	}
+}
+
+// add records the boundaries of every port range of the list, and the ports
+// right outside of them, along with every protocol without ports.
+func (s *sampler) add(protocolPorts []string) {
+
+	for _, entry := range protocolPorts {
+
+		parts := strings.SplitN(strings.ToLower(entry), "/", 2)
+		protocol := parts[0]
+
+		if protocol == protocolAny {
+			continue
+		}
+
+		if protocol != protocolTCP && protocol != protocolUDP {
+			s.protocols[protocol] = struct{}{}
+			continue
+		}
+
+		if len(parts) < 2 {
+			continue
+		}
+
+		spec, err := intersection.NewPortSpecFromString(parts[1], nil)
+		if err != nil {
+			continue
+		}
+
+		for _, port := range []int{int(spec.Min) - 1, int(spec.Min), int(spec.Max), int(spec.Max) + 1} {
+			if port >= 1 && port <= maxPort {
+				s.ports[protocol][port] = struct{}{}
+			}
+		}
+	}
+}
+
+// sample is a protocol and port to test.
+type sample struct {
+	protocol string
+	port     int
+}
+
+// samples returns the recorded protocols and ports in a stable order.
+func (s *sampler) samples() []sample {
+
+	out := []sample{}
+
+	for _, protocol := range []string{protocolTCP, protocolUDP} {
+		ports := make([]int, 0, len(s.ports[protocol]))
+		for port := range s.ports[protocol] {
+			ports = append(ports, port)
+		}
+		sort.Ints(ports)
+		for _, port := range ports {
+			out = append(out, sample{protocol: protocol, port: port})
+		}
+	}
+
+	protocols := make([]string, 0, len(s.protocols))
+	for protocol := range s.protocols {
+		protocols = append(protocols, protocol)
+	}
+	sort.Strings(protocols)
+	for _, protocol := range protocols {
+		out = append(out, sample{protocol: protocol})
+	}
+
+	return out
+}
@@ -0,0 +1,112 @@
+package verify
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Query describes the traffic to simulate.
+type Query struct {
+	// Source are the tags of the source. Tags holding $identity=externalnetwork
+	// designate the external network named by the $name= tag, or the first
+	// external network carrying the other tags.
+	Source []string
+
+	// Destination are the tags of the destination, like the source.
+	Destination []string
+
+	// Protocol is the protocol of the traffic, like tcp, udp or icmp.
+	Protocol string
+
+	// Port is the port of the traffic for tcp and udp.
+	Port int
+}
+
+// ParseProtocolPort parses a protocol and port like "tcp/443" or "icmp".
+func ParseProtocolPort(s string) (protocol string, port int, err error) {
+
+	parts := strings.SplitN(strings.ToLower(s), "/", 2)
+	protocol = parts[0]
+
+	if protocol == "" {
+		return "", 0, fmt.Errorf("missing protocol in '%s'", s)
+	}
+
+	if protocol != protocolTCP && protocol != protocolUDP {
+		return protocol, 0, nil
+	}
+
+	if len(parts) < 2 {
+		return "", 0, fmt.Errorf("missing port in '%s'", s)
+	}
+
+	port, err = strconv.Atoi(parts[1])
+	if err != nil || port < 1 || port > maxPort {
+		return "", 0, fmt.Errorf("invalid port in '%s'", s)
+	}
+
+	return protocol, port, nil
+}
+
+// Simulation is the result of the simulation of a flow in both models.
+type Simulation struct {
+	Flow *Flow
+	V1   *Evaluation
+	V2   *Evaluation
+}
+
+// Simulate evaluates the traffic described by the query against the network
+// access policies and the network rule set policies of the input.
+func Simulate(input *Input, q *Query) (*Simulation, error) {
+
+	src, err := resolveEndpoint(input, q.Source)
+	if err != nil {
+		return nil, fmt.Errorf("source: %w", err)
+	}
+
+	dst, err := resolveEndpoint(input, q.Destination)
+	if err != nil {
+		return nil, fmt.Errorf("destination: %w", err)
+	}
+
+	f := &Flow{
+		Source:      src,
+		Destination: dst,
+		Protocol:    strings.ToLower(q.Protocol),
+		Port:        q.Port,
+	}
+
+	return &Simulation{
+		Flow: f,
+		V1:   EvaluateV1(f, input.NetworkAccessPolicies),
+		V2:   EvaluateV2(f, input.NetworkRuleSetPolicies, input.IneffectiveTag),
+	}, nil
+}
+
+// resolveEndpoint returns the endpoint described by the tags.
+func resolveEndpoint(input *Input, tags []string) (*Endpoint, error) {
+
+	if len(tags) == 0 {
+		return nil, fmt.Errorf("no tags")
+	}
+
+	if !contains(tags, identityExternalNetwork) {
+		return NewProcessingUnitEndpoint(tags), nil
+	}
+
+	for _, extnet := range input.ExternalNetworks {
+		e := NewExternalNetworkEndpoint(extnet, input.ConvertedExternalNetworks)
+		if e.matchesClause(tags, e.Tags) {
+			return e, nil
+		}
+	}
+
+	for _, tag := range tags {
+		if strings.HasPrefix(tag, namePrefix) {
+			return nil, fmt.Errorf("no external network named '%s'", strings.TrimPrefix(tag, namePrefix))
+		}
+	}
+
+	return nil, fmt.Errorf("no external network matching %v", tags)
+}
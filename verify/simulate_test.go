@@ -0,0 +1,106 @@
+package verify
+
+import (
+	"testing"
+)
+
+func TestSimulate(t *testing.T) {
+
+	npl, enl := samplePolicies()
+	input := convert(t, npl, enl)
+
+	tests := []struct {
+		name        string
+		query       *Query
+		want        Verdict
+		wantMatches int
+	}{
+		{
+			"allowed",
+			&Query{Source: []string{"app=frontend"}, Destination: []string{"app=backend"}, Protocol: "tcp", Port: 8000},
+			VerdictAllow,
+			2,
+		},
+		{
+			"rejected port",
+			&Query{Source: []string{"app=frontend"}, Destination: []string{"app=backend"}, Protocol: "tcp", Port: 8080},
+			VerdictReject,
+			4,
+		},
+		{
+			"no policy",
+			&Query{Source: []string{"app=backend"}, Destination: []string{"app=frontend"}, Protocol: "tcp", Port: 8000},
+			VerdictReject,
+			0,
+		},
+		{
+			"external network",
+			&Query{Source: []string{"app=backend"}, Destination: []string{"$identity=externalnetwork", "$name=internet"}, Protocol: "tcp", Port: 443},
+			VerdictAllow,
+			1,
+		},
+		{
+			"external network service port",
+			&Query{Source: []string{"app=backend"}, Destination: []string{"$identity=externalnetwork", "ext=internet"}, Protocol: "tcp", Port: 80},
+			VerdictReject,
+			0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+
+			s, err := Simulate(input, tt.query)
+			if err != nil {
+				t.Fatalf("Simulate() error = %v", err)
+			}
+
+			for model, e := range map[string]*Evaluation{"v1": s.V1, "v2": s.V2} {
+				if e.Verdict != tt.want {
+					t.Errorf("Simulate() %s verdict = %v, want %v", model, e.Verdict, tt.want)
+				}
+				if len(e.Matches) != tt.wantMatches {
+					t.Errorf("Simulate() %s matches = %v, want %d", model, e.Matches, tt.wantMatches)
+				}
+			}
+		})
+	}
+}
+
+func TestSimulateUnknownExternalNetwork(t *testing.T) {
+
+	npl, enl := samplePolicies()
+	input := convert(t, npl, enl)
+
+	q := &Query{Source: []string{"app=backend"}, Destination: []string{"$identity=externalnetwork", "$name=intranet"}, Protocol: "tcp", Port: 443}
+	if _, err := Simulate(input, q); err == nil {
+		t.Errorf("Simulate() expected an error")
+	}
+}
+
+func TestParseProtocolPort(t *testing.T) {
+
+	tests := []struct {
+		in           string
+		wantProtocol string
+		wantPort     int
+		wantErr      bool
+	}{
+		{"tcp/443", "tcp", 443, false},
+		{"UDP/53", "udp", 53, false},
+		{"icmp", "icmp", 0, false},
+		{"tcp", "", 0, true},
+		{"tcp/70000", "", 0, true},
+		{"", "", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			protocol, port, err := ParseProtocolPort(tt.in)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseProtocolPort() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if protocol != tt.wantProtocol || port != tt.wantPort {
+				t.Errorf("ParseProtocolPort() = %s %d, want %s %d", protocol, port, tt.wantProtocol, tt.wantPort)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package verify
+
+import (
+	"fmt"
+	"math/bits"
+	"sort"
+	"strings"
+
+	"go.aporeto.io/gaia"
+)
+
+// Input holds the objects to compare.
+type Input struct {
+	// NetworkAccessPolicies are the policies that were converted.
+	NetworkAccessPolicies gaia.NetworkAccessPoliciesList
+
+	// ExternalNetworks are the external networks given to the conversion.
+	ExternalNetworks gaia.ExternalNetworksList
+
+	// NetworkRuleSetPolicies are the policies produced by the conversion.
+	NetworkRuleSetPolicies gaia.NetworkRuleSetPoliciesList
+
+	// ConvertedExternalNetworks are the external networks produced by the conversion.
+	ConvertedExternalNetworks gaia.ExternalNetworksList
+
+	// IneffectiveTag is the tag the conversion used to mark the rules matching no traffic.
+	IneffectiveTag string
+
+	// MaxFlows is the maximum number of flows Verify evaluates. When there are more
+	// flows, an evenly spread sample of them is evaluated. Zero means no limit.
+	MaxFlows int
+}
+
+// Mismatch is a flow that does not get the same verdict in both models.
+type Mismatch struct {
+	Flow *Flow
+	V1   Verdict
+	V2   Verdict
+}
+
+func (m *Mismatch) String() string {
+	return fmt.Sprintf("%s: v1 %s, v2 %s", m.Flow, m.V1, m.V2)
+}
+
+// Result is the result of a verification.
+type Result struct {
+	// Flows is the number of flows evaluated.
+	Flows int
+
+	// Skipped is the number of flows left out because of Input.MaxFlows.
+	Skipped int
+
+	// Mismatches are the flows with a different verdict in both models.
+	Mismatches []*Mismatch
+}
+
+// Equivalent returns true if every flow got the same verdict in both models.
+func (r *Result) Equivalent() bool {
+	return len(r.Mismatches) == 0
+}
+
+// Verify enumerates representative flows between the endpoints selected by the
+// policies and reports every flow whose verdict differs between the network
+// access policies and the network rule set policies.
+//
+// The endpoints are the processing units described by each 'AND' clause of the
+// policies, and an address of every external network. The ports are the
+// boundaries of the ports used by the policies and external networks, along
+// with the ports right outside of them. The number of flows grows with the square
+// of the number of endpoints, see Input.MaxFlows to bound it.
+func Verify(input *Input) *Result {
+
+	processingUnits, extnets := enumerateEndpoints(input)
+	space := &flowSpace{
+		processingUnits: processingUnits,
+		endpoints:       append(append([]*Endpoint{}, processingUnits...), extnets...),
+		samples:         enumerateSamples(input),
+	}
+
+	result := &Result{
+		Mismatches: []*Mismatch{},
+	}
+
+	total := space.len()
+	count := total
+	if input.MaxFlows > 0 && total > uint64(input.MaxFlows) {
+		count = uint64(input.MaxFlows)
+		result.Skipped = int(total - count)
+	}
+
+	for i := uint64(0); i < count; i++ {
+
+		// Spread the evaluated flows evenly over all the flows: i * total / count
+		index := i
+		if count != total {
+			hi, lo := bits.Mul64(i, total)
+			index, _ = bits.Div64(hi, lo, count)
+		}
+
+		f := space.flow(index)
+
+		result.Flows++
+
+		v1 := EvaluateV1(f, input.NetworkAccessPolicies).Verdict
+		v2 := EvaluateV2(f, input.NetworkRuleSetPolicies, input.IneffectiveTag).Verdict
+		if v1 != v2 {
+			result.Mismatches = append(result.Mismatches, &Mismatch{Flow: f, V1: v1, V2: v2})
+		}
+	}
+
+	return result
+}
+
+// flowSpace indexes the flows between the endpoints without building them: the flows from
+// every processing unit to every endpoint, then from every external network to every processing
+// unit, each with every sample. Traffic between external networks is not enforced.
+type flowSpace struct {
+	// processingUnits are the first endpoints.
+	processingUnits []*Endpoint
+	endpoints       []*Endpoint
+	samples         []sample
+}
+
+// len returns the number of flows.
+func (s *flowSpace) len() uint64 {
+
+	pu, all := uint64(len(s.processingUnits)), uint64(len(s.endpoints))
+
+	return (pu*all + (all-pu)*pu) * uint64(len(s.samples))
+}
+
+// flow returns the flow of the given index, lower than len.
+func (s *flowSpace) flow(i uint64) *Flow {
+
+	samples := uint64(len(s.samples))
+	pu, all := uint64(len(s.processingUnits)), uint64(len(s.endpoints))
+
+	smp := s.samples[i%samples]
+	pair := i / samples
+
+	var src, dst *Endpoint
+	if pair < pu*all {
+		src, dst = s.endpoints[pair/all], s.endpoints[pair%all]
+	} else {
+		pair -= pu * all
+		src, dst = s.endpoints[pu+pair/pu], s.processingUnits[pair%pu]
+	}
+
+	return &Flow{
+		Source:      src,
+		Destination: dst,
+		Protocol:    smp.protocol,
+		Port:        smp.port,
+	}
+}
+
+// enumerateEndpoints returns the processing units selected by the policies, and the external networks.
+// Like the converter, a clause selecting an external network is not used to describe a processing unit.
+// The clauses holding the same tags in a different order describe a single processing unit.
+func enumerateEndpoints(input *Input) (processingUnits []*Endpoint, extnets []*Endpoint) {
+
+	extnets = make([]*Endpoint, len(input.ExternalNetworks))
+	for i, extnet := range input.ExternalNetworks {
+		extnets[i] = NewExternalNetworkEndpoint(extnet, input.ConvertedExternalNetworks)
+	}
+
+	selectsExternalNetwork := func(clause []string) bool {
+		for _, e := range extnets {
+			if e.matchesClause(clause, e.Tags) {
+				return true
+			}
+		}
+		return false
+	}
+
+	endpoints := []*Endpoint{}
+	seen := map[string]struct{}{}
+
+	addClauses := func(clauses [][]string) {
+		for _, clause := range clauses {
+
+			if len(clause) == 0 || contains(clause, identityExternalNetwork) || selectsExternalNetwork(clause) {
+				continue
+			}
+
+			if input.IneffectiveTag != "" && len(clause) == 1 && clause[0] == input.IneffectiveTag {
+				continue
+			}
+
+			e := NewProcessingUnitEndpoint(clause)
+			key := endpointKey(e)
+			if _, ok := seen[key]; ok {
+				continue
+			}
+			seen[key] = struct{}{}
+			endpoints = append(endpoints, e)
+		}
+	}
+
+	for _, p := range input.NetworkAccessPolicies {
+		addClauses(p.Subject)
+		addClauses(p.Object)
+	}
+
+	for _, p := range input.NetworkRuleSetPolicies {
+		addClauses(p.Subject)
+		for _, rule := range p.IncomingRules {
+			addClauses(rule.Object)
+		}
+		for _, rule := range p.OutgoingRules {
+			addClauses(rule.Object)
+		}
+	}
+
+	return endpoints, extnets
+}
+
+// endpointKey returns a key identifying the endpoints with the same tags.
+func endpointKey(e *Endpoint) string {
+
+	tags := append([]string{}, e.Tags...)
+	sort.Strings(tags)
+
+	return strings.Join(tags, "\x00")
+}
+
+// enumerateSamples returns the protocols and ports used by the policies and external networks.
+func enumerateSamples(input *Input) []sample {
+
+	s := newSampler()
+
+	for _, p := range input.NetworkAccessPolicies {
+		s.add(p.Ports)
+	}
+
+	for _, extnet := range input.ExternalNetworks {
+		s.add(extnet.ServicePorts)
+	}
+
+	for _, p := range input.NetworkRuleSetPolicies {
+		for _, rule := range p.IncomingRules {
+			s.add(rule.ProtocolPorts)
+		}
+		for _, rule := range p.OutgoingRules {
+			s.add(rule.ProtocolPorts)
+		}
+	}
+
+	return s.samples()
+}
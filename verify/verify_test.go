@@ -0,0 +1,341 @@
+package verify
+
+import (
+	"testing"
+
+	"github.com/satyamsi/migrate/rulesetpolicies"
+	"go.aporeto.io/gaia"
+)
+
+// convert converts the policies like the convert command does.
+func convert(t *testing.T, npl gaia.NetworkAccessPoliciesList, enl gaia.ExternalNetworksList) *Input {
+
+	t.Helper()
+
+	return convertWithOptions(t, npl, enl, rulesetpolicies.DefaultOptions())
+}
+
+func convertWithOptions(t *testing.T, npl gaia.NetworkAccessPoliciesList, enl gaia.ExternalNetworksList, opts rulesetpolicies.Options) *Input {
+
+	t.Helper()
+
+	input := &Input{
+		NetworkAccessPolicies:     npl,
+		ExternalNetworks:          enl,
+		NetworkRuleSetPolicies:    gaia.NetworkRuleSetPoliciesList{},
+		ConvertedExternalNetworks: gaia.ExternalNetworksList{},
+		IneffectiveTag:            opts.IneffectiveTag,
+	}
+
+	extnets := rulesetpolicies.NewExternalNetworkSet()
+	for _, np := range npl {
+		rsl, netl, _, err := rulesetpolicies.ConvertToNetworkRuleSetPolicies(np, enl, opts)
+		if err != nil {
+			t.Fatalf("ConvertToNetworkRuleSetPolicies() error = %v", err)
+		}
+		if err := extnets.Add(np.Name, netl); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+		input.NetworkRuleSetPolicies = append(input.NetworkRuleSetPolicies, rsl...)
+	}
+	input.ConvertedExternalNetworks = extnets.List()
+
+	return input
+}
+
+func samplePolicies() (gaia.NetworkAccessPoliciesList, gaia.ExternalNetworksList) {
+
+	internet := gaia.NewExternalNetwork()
+	internet.Name = "internet"
+	internet.AssociatedTags = []string{"ext=internet"}
+	internet.Entries = []string{"0.0.0.0/0"}
+	internet.ServicePorts = []string{"tcp/80", "tcp/443", "udp/53"}
+
+	np1 := gaia.NewNetworkAccessPolicy()
+	np1.Name = "frontend-to-backend"
+	np1.Namespace = "/ns"
+	np1.Subject = [][]string{{"app=frontend"}}
+	np1.Object = [][]string{{"app=backend"}}
+	np1.Ports = []string{"tcp/8000:8080"}
+
+	np2 := gaia.NewNetworkAccessPolicy()
+	np2.Name = "backend-to-internet"
+	np2.Namespace = "/ns"
+	np2.ApplyPolicyMode = gaia.NetworkAccessPolicyApplyPolicyModeOutgoingTraffic
+	np2.Subject = [][]string{{"app=backend"}}
+	np2.Object = [][]string{{"ext=internet"}}
+	np2.Ports = []string{"tcp/443"}
+
+	np3 := gaia.NewNetworkAccessPolicy()
+	np3.Name = "reject-admin"
+	np3.Namespace = "/ns"
+	np3.Action = gaia.NetworkAccessPolicyActionReject
+	np3.Subject = [][]string{{"app=frontend"}}
+	np3.Object = [][]string{{"app=backend"}}
+	np3.Ports = []string{"tcp/8080"}
+
+	return gaia.NetworkAccessPoliciesList{np1, np2, np3}, gaia.ExternalNetworksList{internet}
+}
+
+func TestVerify(t *testing.T) {
+
+	npl, enl := samplePolicies()
+	input := convert(t, npl, enl)
+
+	result := Verify(input)
+
+	if result.Flows == 0 {
+		t.Fatalf("Verify() evaluated no flow")
+	}
+
+	if !result.Equivalent() {
+		for _, m := range result.Mismatches {
+			t.Errorf("Verify() mismatch: %s", m)
+		}
+	}
+}
+
+func TestVerifyMerged(t *testing.T) {
+
+	npl, enl := samplePolicies()
+	input := convert(t, npl, enl)
+
+	var merges []*rulesetpolicies.Merge
+	input.NetworkRuleSetPolicies, merges = rulesetpolicies.MergeRuleSetPolicies(input.NetworkRuleSetPolicies)
+	if len(merges) == 0 {
+		t.Fatalf("MergeRuleSetPolicies() merged no policy")
+	}
+
+	for _, m := range Verify(input).Mismatches {
+		t.Errorf("Verify() mismatch: %s", m)
+	}
+}
+
+func TestVerifyNamespaces(t *testing.T) {
+
+	// Same external network name in a parent and a sibling namespace
+	parent := &gaia.ExternalNetwork{Name: "internet", Namespace: "/corp", Propagate: true, AssociatedTags: []string{"ext=internet"}, Entries: []string{"0.0.0.0/0"}, ServicePorts: []string{"tcp/443"}}
+	sibling := &gaia.ExternalNetwork{Name: "internet", Namespace: "/corp/lab", Propagate: true, AssociatedTags: []string{"ext=internet"}, Entries: []string{"0.0.0.0/0"}, ServicePorts: []string{"tcp/80"}}
+
+	np := gaia.NewNetworkAccessPolicy()
+	np.Name = "backend-to-internet"
+	np.Namespace = "/corp/dmz"
+	np.ApplyPolicyMode = gaia.NetworkAccessPolicyApplyPolicyModeOutgoingTraffic
+	np.Subject = [][]string{{"app=backend"}}
+	np.Object = [][]string{{"ext=internet"}}
+
+	input := convert(t, gaia.NetworkAccessPoliciesList{np}, gaia.ExternalNetworksList{parent, sibling})
+
+	if len(input.ConvertedExternalNetworks) != 1 || input.ConvertedExternalNetworks[0].Namespace != "/corp" {
+		t.Fatalf("ConvertToNetworkRuleSetPolicies() external networks = %v, want the one of /corp", input.ConvertedExternalNetworks)
+	}
+
+	for _, m := range Verify(input).Mismatches {
+		t.Errorf("Verify() mismatch: %s", m)
+	}
+
+	src := NewProcessingUnitEndpoint([]string{"app=backend"})
+	for _, tt := range []struct {
+		extnet *gaia.ExternalNetwork
+		port   int
+		want   Verdict
+	}{
+		{parent, 443, VerdictAllow},
+		{sibling, 80, VerdictReject},
+	} {
+		f := &Flow{Source: src, Destination: NewExternalNetworkEndpoint(tt.extnet, input.ConvertedExternalNetworks), Protocol: protocolTCP, Port: tt.port}
+		if got := EvaluateV1(f, input.NetworkAccessPolicies).Verdict; got != tt.want {
+			t.Errorf("EvaluateV1(%s) = %s, want %s", f, got, tt.want)
+		}
+		if got := EvaluateV2(f, input.NetworkRuleSetPolicies, input.IneffectiveTag).Verdict; got != tt.want {
+			t.Errorf("EvaluateV2(%s) = %s, want %s", f, got, tt.want)
+		}
+	}
+}
+
+func TestVerifySelectors(t *testing.T) {
+
+	npl, enl := samplePolicies()
+	enl[0].ID = "5f8e"
+
+	np := gaia.NewNetworkAccessPolicy()
+	np.Name = "frontend-to-internet"
+	np.Namespace = "/ns"
+	np.ApplyPolicyMode = gaia.NetworkAccessPolicyApplyPolicyModeOutgoingTraffic
+	np.Subject = [][]string{{"app=frontend"}}
+	np.Object = [][]string{{"$identity=externalnetwork", "$name=internet"}, {"$id=5f8e"}}
+	np.Ports = []string{"udp/53"}
+
+	input := convert(t, append(npl, np), enl)
+
+	for _, m := range Verify(input).Mismatches {
+		t.Errorf("Verify() mismatch: %s", m)
+	}
+}
+
+func TestVerifyDowngrade(t *testing.T) {
+
+	npl, enl := samplePolicies()
+	input := convert(t, npl, enl)
+
+	// The downgraded policies take the same decisions as the rule sets they come from
+	npl, enl, _, err := rulesetpolicies.ConvertToNetworkAccessPolicies(input.NetworkRuleSetPolicies, append(enl, input.ConvertedExternalNetworks...), rulesetpolicies.DefaultOptions())
+	if err != nil {
+		t.Fatalf("ConvertToNetworkAccessPolicies() error = %v", err)
+	}
+	input.NetworkAccessPolicies = npl
+	input.ExternalNetworks = enl
+
+	result := Verify(input)
+	if result.Flows == 0 {
+		t.Fatalf("Verify() evaluated no flow")
+	}
+	for _, m := range result.Mismatches {
+		t.Errorf("Verify() mismatch: %s", m)
+	}
+}
+
+func TestVerifyIneffective(t *testing.T) {
+
+	npl, enl := samplePolicies()
+
+	// No service port of the external network is allowed by the policy
+	np := gaia.NewNetworkAccessPolicy()
+	np.Name = "backend-to-internet-ssh"
+	np.Namespace = "/ns"
+	np.ApplyPolicyMode = gaia.NetworkAccessPolicyApplyPolicyModeOutgoingTraffic
+	np.Subject = [][]string{{"app=backend"}}
+	np.Object = [][]string{{"ext=internet"}}
+	np.Ports = []string{"tcp/22"}
+	npl = append(npl, np)
+
+	for _, drop := range []bool{false, true} {
+
+		opts := rulesetpolicies.DefaultOptions()
+		opts.DropIneffective = drop
+
+		for _, m := range Verify(convertWithOptions(t, npl, enl, opts)).Mismatches {
+			t.Errorf("Verify() mismatch with DropIneffective %t: %s", drop, m)
+		}
+	}
+}
+
+func TestVerifyMismatches(t *testing.T) {
+
+	npl, enl := samplePolicies()
+	input := convert(t, npl, enl)
+
+	// Drop the reject rule set so the frontend can reach the admin port
+	rsl := gaia.NetworkRuleSetPoliciesList{}
+	for _, p := range input.NetworkRuleSetPolicies {
+		if p.Name != "reject-admin" {
+			rsl = append(rsl, p)
+		}
+	}
+	input.NetworkRuleSetPolicies = rsl
+
+	result := Verify(input)
+
+	if result.Equivalent() {
+		t.Fatalf("Verify() expected mismatches")
+	}
+
+	for _, m := range result.Mismatches {
+		if m.Flow.Protocol != "tcp" || m.Flow.Port != 8080 {
+			t.Errorf("Verify() unexpected mismatch: %s", m)
+		}
+		if m.V1 != VerdictReject || m.V2 != VerdictAllow {
+			t.Errorf("Verify() unexpected verdicts: %s", m)
+		}
+	}
+}
+
+func TestVerifyObservation(t *testing.T) {
+
+	for _, action := range []gaia.NetworkAccessPolicyObservedTrafficActionValue{
+		gaia.NetworkAccessPolicyObservedTrafficActionApply,
+		gaia.NetworkAccessPolicyObservedTrafficActionContinue,
+	} {
+		t.Run(string(action), func(t *testing.T) {
+
+			npl, enl := samplePolicies()
+			for _, np := range npl {
+				if np.Name == "reject-admin" {
+					np.ObservationEnabled = true
+					np.ObservedTrafficAction = action
+				}
+			}
+
+			result := Verify(convert(t, npl, enl))
+			for _, m := range result.Mismatches {
+				t.Errorf("Verify() mismatch: %s", m)
+			}
+		})
+	}
+}
+
+func Test_portsMatch(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		ports    []string
+		protocol string
+		port     int
+		want     bool
+	}{
+		{"empty", nil, "tcp", 80, true},
+		{"any", []string{"any"}, "udp", 53, true},
+		{"port", []string{"tcp/80"}, "tcp", 80, true},
+		{"other port", []string{"tcp/80"}, "tcp", 81, false},
+		{"other protocol", []string{"tcp/80"}, "udp", 80, false},
+		{"range", []string{"udp/1000:2000"}, "udp", 1500, true},
+		{"protocol without ports", []string{"icmp/8/0"}, "icmp", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := portsMatch(tt.ports, tt.protocol, tt.port); got != tt.want {
+				t.Errorf("portsMatch() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyMaxFlows(t *testing.T) {
+
+	npl, enl := samplePolicies()
+
+	// The same processing unit, with its tags in another order
+	npl[0].Subject = append(npl[0].Subject, []string{"$identity=processingunit", "app=frontend"})
+
+	input := convert(t, npl, enl)
+
+	all := Verify(input)
+	if all.Skipped != 0 || !all.Equivalent() {
+		t.Fatalf("Verify() = %d flows, %d skipped, %v, want every flow verified", all.Flows, all.Skipped, all.Mismatches)
+	}
+
+	if processingUnits, extnets := enumerateEndpoints(input); len(processingUnits) != 2 || len(extnets) != 1 {
+		t.Errorf("enumerateEndpoints() = %d processing units, %d external networks, want 2 and 1", len(processingUnits), len(extnets))
+	}
+
+	// The flows are every pair of endpoints but the ones between external networks, once
+	processingUnits, extnets := enumerateEndpoints(input)
+	space := &flowSpace{processingUnits: processingUnits, endpoints: append(processingUnits, extnets...), samples: enumerateSamples(input)}
+	seen := map[string]struct{}{}
+	for i := uint64(0); i < space.len(); i++ {
+		f := space.flow(i)
+		if f.Source.IsExternalNetwork() && f.Destination.IsExternalNetwork() {
+			t.Errorf("flowSpace.flow(%d) = %s, want no flow between external networks", i, f)
+		}
+		seen[f.String()] = struct{}{}
+	}
+	if want := 8 * len(space.samples); len(seen) != want || int(space.len()) != want || all.Flows != want {
+		t.Errorf("flowSpace = %d flows, %d unique, Verify() = %d, want %d", space.len(), len(seen), all.Flows, want)
+	}
+
+	input.MaxFlows = all.Flows / 3
+	result := Verify(input)
+	if result.Flows != input.MaxFlows || result.Flows+result.Skipped != all.Flows {
+		t.Errorf("Verify() = %d flows, %d skipped, want %d of %d", result.Flows, result.Skipped, input.MaxFlows, all.Flows)
+	}
+}